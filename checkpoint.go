@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/cschneider4711/quick-npm-module-scanner/scanner"
+)
+
+// checkpoint records the scan roots that were completely scanned, with
+// their IOC matches, so an interrupted scan can be resumed with -resume
+type checkpoint struct {
+	Completed []checkpointRoot `json:"completed"`
+}
+
+// checkpointRoot is one completely scanned root
+type checkpointRoot struct {
+	Root    string          `json:"root"`
+	Matches []scanner.Match `json:"matches"`
+}
+
+// loadCheckpoint reads a checkpoint file; a missing file is an empty checkpoint
+func loadCheckpoint(path string) (*checkpoint, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &checkpoint{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var c checkpoint
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// completed reports whether root was completely scanned
+func (c *checkpoint) completed(root string) bool {
+	for _, done := range c.Completed {
+		if done.Root == root {
+			return true
+		}
+	}
+	return false
+}
+
+// matches returns the IOC matches of all completed roots
+func (c *checkpoint) matches() []scanner.Match {
+	var matches []scanner.Match
+	for _, done := range c.Completed {
+		matches = append(matches, done.Matches...)
+	}
+	return matches
+}
+
+// save writes the checkpoint atomically, so an interruption never leaves a
+// truncated checkpoint behind
+func (c *checkpoint) save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return scanner.WriteFileAtomic(path, data)
+}
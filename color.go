@@ -0,0 +1,38 @@
+package main
+
+import (
+	"os"
+)
+
+// ANSI color codes
+const (
+	colorRed    = "31"
+	colorYellow = "33"
+	colorGreen  = "32"
+)
+
+// colorReport enables colored match lines in the text report
+var colorReport bool
+
+// useColor reports whether output to f should be colored: only terminals
+// are, and never when NO_COLOR is set (https://no-color.org) or TERM is dumb
+func useColor(f *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	return isTerminal(f)
+}
+
+// isTerminal reports whether f is a terminal (character device)
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// paint wraps s in the given ANSI color
+func paint(color, s string) string {
+	return "\x1b[" + color + "m" + s + "\x1b[0m"
+}
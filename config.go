@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cschneider4711/quick-npm-module-scanner/scanner"
+)
+
+// Config holds the scanner settings, one field per command-line flag; the
+// flag tag names the flag. Flags are parsed into it, and a config file
+// passed with -config fills in the fields not given on the command line.
+type Config struct {
+	ConfigFile          string        `flag:"config"`
+	IOC                 stringList    `flag:"ioc"`
+	IOCTimeout          time.Duration `flag:"ioc-timeout"`
+	IOCRetries          int           `flag:"ioc-retries"`
+	IOCRetryBackoff     time.Duration `flag:"ioc-retry-backoff"`
+	IOCCache            string        `flag:"ioc-cache"`
+	IOCSHA256           string        `flag:"ioc-sha256"`
+	IOCCacheTTL         time.Duration `flag:"ioc-cache-ttl"`
+	BaseDir             string        `flag:"base-dir"`
+	Paths               stringList    `flag:"paths"`
+	Global              bool          `flag:"global"`
+	Format              string        `flag:"format"`
+	Checkpoint          string        `flag:"checkpoint"`
+	Resume              bool          `flag:"resume"`
+	Timeout             time.Duration `flag:"timeout"`
+	StopOnFirstMatch    bool          `flag:"stop-on-first-match"`
+	Workers             int           `flag:"workers"`
+	Stream              bool          `flag:"stream"`
+	Progress            bool          `flag:"progress"`
+	SummaryOnly         bool          `flag:"summary-only"`
+	Quiet               bool          `flag:"quiet"`
+	LogLevel            string        `flag:"log-level"`
+	NoColor             bool          `flag:"no-color"`
+	LogFormat           string        `flag:"log-format"`
+	Exclude             stringList    `flag:"exclude"`
+	Include             stringList    `flag:"include"`
+	MaxDepth            int           `flag:"max-depth"`
+	ContentRules        string        `flag:"content-rules"`
+	Allowlist           string        `flag:"allowlist"`
+	FlagInstallScripts  bool          `flag:"flag-install-scripts"`
+	CheckProvenance     bool          `flag:"check-provenance"`
+	Score               bool          `flag:"score"`
+	ScoreThreshold      int           `flag:"score-threshold"`
+	NewerThan           string        `flag:"newer-than"`
+	LenientJSON         bool          `flag:"lenient-json"`
+	CheckPerms          bool          `flag:"check-perms"`
+	MtimeCheck          bool          `flag:"mtime-check"`
+	ModifiedAfter       string        `flag:"modified-after"`
+	CheckDeps           bool          `flag:"check-deps"`
+	MaxOpenFiles        int           `flag:"max-open-files"`
+	MaxFileSize         int64         `flag:"max-file-size"`
+	MetricsFile         string        `flag:"metrics-file"`
+	Output              string        `flag:"output"`
+	Inventory           bool          `flag:"inventory"`
+	ReportDuplicates    bool          `flag:"report-duplicates"`
+	RelativePaths       bool          `flag:"relative-paths"`
+	RelativeTo          string        `flag:"relative-to"`
+	Flat                bool          `flag:"flat"`
+	Dedupe              bool          `flag:"dedupe"`
+	IgnoreBuildMetadata bool          `flag:"ignore-build-metadata"`
+	IgnoreNameCase      bool          `flag:"ignore-name-case"`
+	ScanTarballs        bool          `flag:"scan-tarballs"`
+	ScanHidden          bool          `flag:"scan-hidden"`
+	Workspaces          bool          `flag:"workspaces"`
+	FollowSymlinks      bool          `flag:"follow-symlinks"`
+	Baseline            string        `flag:"baseline"`
+	BaselineIgnorePath  bool          `flag:"baseline-ignore-path"`
+	UpdateBaseline      bool          `flag:"update-baseline"`
+	ValidateIOC         bool          `flag:"validate-ioc"`
+	Diff                bool          `flag:"diff"`
+	DryRun              bool          `flag:"dry-run"`
+	FailOnError         bool          `flag:"fail-on-error"`
+	ExitCodeMap         string        `flag:"exit-code-map"`
+	FailOn              string        `flag:"fail-on"`
+
+	fromFile map[string]bool // flags set by the config file
+}
+
+// registerFlags defines the command-line flags in fs, storing their values
+// in c
+func (c *Config) registerFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.ConfigFile, "config", "", "Config file setting flag values (\"key: value\" lines); explicit flags take precedence")
+	fs.Var(&c.IOC, "ioc", "Path or http(s):// URL of IOC file (repeatable or comma-separated; entries are merged, default ioc.txt)")
+	fs.DurationVar(&c.IOCTimeout, "ioc-timeout", 30*time.Second, "Timeout for fetching a remote IOC file")
+	fs.IntVar(&c.IOCRetries, "ioc-retries", 2, "Retry fetching a remote IOC file this many times after a 5xx status or network error")
+	fs.DurationVar(&c.IOCRetryBackoff, "ioc-retry-backoff", time.Second, "Delay before the first retry of a remote IOC fetch, doubled for each further retry")
+	fs.StringVar(&c.IOCCache, "ioc-cache", "", "Cache remote IOC files in this directory; stale copies are revalidated, and used if the server is unreachable")
+	fs.StringVar(&c.IOCSHA256, "ioc-sha256", "", "Expected SHA-256 (hex) of the IOC file; loading fails with exit 2 if its contents differ (single IOC source only)")
+	fs.DurationVar(&c.IOCCacheTTL, "ioc-cache-ttl", time.Hour, "Age up to which a cached remote IOC file is used without contacting the server (with -ioc-cache)")
+	fs.StringVar(&c.BaseDir, "base-dir", "", "Resolve relative scan paths (from paths files and arguments) against this directory instead of the working directory")
+	fs.Var(&c.Paths, "paths", "Path to file containing scan paths (repeatable; \"-\" reads them from stdin, default paths.txt)")
+	fs.BoolVar(&c.Global, "global", true, "Scan paths from paths file (or default paths if file not found); off when paths are given as arguments, unless set explicitly")
+	fs.StringVar(&c.Format, "format", "text", "Output format: text, json, ndjson (one JSON object per line, streamed), sarif, cyclonedx (SBOM of all installed packages, implies -inventory), html (standalone page) or markdown (table, e.g. for PR comments)")
+	fs.StringVar(&c.Checkpoint, "checkpoint", "", "Record the completely scanned roots (and their matches) in this JSON file while scanning; removed once the scan completes")
+	fs.BoolVar(&c.Resume, "resume", false, "Skip the roots recorded as completed in the -checkpoint file, reusing their matches")
+	fs.DurationVar(&c.Timeout, "timeout", 0, "Stop the scan after this duration (e.g. 10m) and report the matches found so far, exiting 124 (0 = no limit)")
+	fs.BoolVar(&c.StopOnFirstMatch, "stop-on-first-match", false, "Stop the scan as soon as a match is found that makes it exit 1 (see -fail-on), e.g. for a fast CI gate")
+	fs.IntVar(&c.Workers, "workers", runtime.NumCPU(), "Number of concurrent workers parsing package.json files")
+	fs.BoolVar(&c.Stream, "stream", false, "Print matches as soon as they are found (text format only, not combined with -dedupe) instead of a sorted list at the end")
+	fs.BoolVar(&c.Progress, "progress", false, "Count the files to check first, then show the scan progress as a percentage on stderr (terminals only)")
+	fs.BoolVar(&c.SummaryOnly, "summary-only", false, "Only print the summary with the number of matches, not the matches themselves (formats text, json, ndjson and markdown); the exit code is unchanged")
+	fs.BoolVar(&c.Quiet, "quiet", false, "Suppress progress and informational output; only matches, warnings and errors are printed (same as -log-level warn)")
+	fs.StringVar(&c.LogLevel, "log-level", "info", "Minimum level of log messages: debug, info, warn or error")
+	fs.BoolVar(&c.NoColor, "no-color", false, "Disable colored output (also disabled by NO_COLOR or when not writing to a terminal)")
+	fs.StringVar(&c.LogFormat, "log-format", "text", "Log format: text or json (JSON lines on stderr)")
+	fs.Var(&c.Exclude, "exclude", "Glob pattern of directories to skip, matched against base name and full path (repeatable, \"**\" matches any number of directories)")
+	fs.Var(&c.Include, "include", "Glob pattern of package names to check, e.g. \"@scope/*\" (repeatable); other packages are skipped. Default: all packages")
+	fs.IntVar(&c.MaxDepth, "max-depth", 0, "Maximum directory levels below each scan root to descend into (0 = unlimited)")
+	fs.StringVar(&c.ContentRules, "content-rules", "", "File of \"name,pattern\" signatures (literal, or \"regex:\" expressions) searched for in the .js, .cjs and .mjs files of installed packages; hits are reported as matches with file and line")
+	fs.StringVar(&c.Allowlist, "allowlist", "", "File of packages verified as safe, in the IOC format; matching entries are dropped from the results")
+	fs.BoolVar(&c.FlagInstallScripts, "flag-install-scripts", false, "Also list installed packages defining preinstall, install or postinstall scripts (informational, does not affect the exit code)")
+	fs.BoolVar(&c.CheckProvenance, "check-provenance", false, "Also list installed packages whose package.json references no provenance attestation (a weak signal, informational, does not affect the exit code)")
+	fs.BoolVar(&c.Score, "score", false, "Also list installed packages by a heuristic suspicion score (install scripts, obfuscated main file, recent modification, no repository, single maintainer); informational, does not affect the exit code")
+	fs.IntVar(&c.ScoreThreshold, "score-threshold", scanner.DefaultScoreThreshold, "Minimum suspicion score of the packages listed by -score")
+	fs.StringVar(&c.NewerThan, "newer-than", "", "Only report packages (and lockfiles) modified after this date, as 2006-01-02 or RFC 3339, e.g. those installed since a campaign started")
+	fs.BoolVar(&c.LenientJSON, "lenient-json", false, "Retry package.json files that are not strict JSON with comments and trailing commas removed, instead of skipping them")
+	fs.BoolVar(&c.CheckPerms, "check-perms", false, "Also list node_modules directories and installed package.json files writable by group or others (not on Windows); informational, does not affect the exit code")
+	fs.BoolVar(&c.MtimeCheck, "mtime-check", false, "Also list installed packages with files modified after they were installed (per the install marker in node_modules, or -modified-after); informational, does not affect the exit code")
+	fs.StringVar(&c.ModifiedAfter, "modified-after", "", "Reference date for -mtime-check instead of the install time, as 2006-01-02 or RFC 3339 (implies -mtime-check)")
+	fs.BoolVar(&c.CheckDeps, "check-deps", false, "Also flag dependencies declared in project package.json files whose version range allows an IOC-listed version, or that force one via overrides or resolutions")
+	fs.IntVar(&c.MaxOpenFiles, "max-open-files", scanner.DefaultMaxOpenFiles, "Maximum number of package.json files and lockfiles open at the same time, for systems with a low open file limit")
+	fs.Int64Var(&c.MaxFileSize, "max-file-size", scanner.DefaultMaxFileSize, "Skip package.json files larger than this many bytes")
+	fs.StringVar(&c.MetricsFile, "metrics-file", "", "Write Prometheus metrics of the scan to this file (replaced atomically), e.g. for node_exporter's textfile collector")
+	fs.StringVar(&c.Output, "output", "", "Write the report to this file instead of stdout (created or truncated)")
+	fs.BoolVar(&c.Inventory, "inventory", false, "List all installed packages found, not just IOC matches")
+	fs.BoolVar(&c.ReportDuplicates, "report-duplicates", false, "Also list packages installed at more than one version, with their paths")
+	fs.BoolVar(&c.RelativePaths, "relative-paths", false, "Report match paths relative to the scan root they were found under instead of absolute")
+	fs.StringVar(&c.RelativeTo, "relative-to", "", "Report match paths below this directory relative to it; others stay absolute")
+	fs.BoolVar(&c.Flat, "flat", false, "List matches of all scan roots together in the text report instead of grouped by root")
+	fs.BoolVar(&c.Dedupe, "dedupe", false, "Collapse matches of the same package name and version into one entry listing all locations")
+	fs.BoolVar(&c.IgnoreBuildMetadata, "ignore-build-metadata", false, "Ignore SemVer build metadata (\"+...\") when comparing exact versions, so 1.0.0+abc matches 1.0.0 (in the IOC sources and the allowlist)")
+	fs.BoolVar(&c.IgnoreNameCase, "ignore-name-case", false, "Compare package names case-insensitively on both the IOC and the scanned side; versions stay case-sensitive")
+	fs.BoolVar(&c.ScanTarballs, "scan-tarballs", false, "Also check the package.json inside .tgz and .tar.gz package tarballs, e.g. in offline mirrors, without extracting them")
+	fs.BoolVar(&c.ScanHidden, "scan-hidden", false, "Also descend into hidden directories (e.g. node_modules/.bin, .cache), which are skipped by default, except node_modules/.pnpm and .yarn")
+	fs.BoolVar(&c.Workspaces, "workspaces", false, "Also scan the workspace directories declared in the package.json of each scan root (or of the project above a node_modules root)")
+	fs.BoolVar(&c.FollowSymlinks, "follow-symlinks", false, "Descend into symlinked directories (e.g. npm link, pnpm), with loop protection")
+	fs.StringVar(&c.Baseline, "baseline", "", "JSON report of known matches; matches listed in it are reported as [KNOWN] and do not cause exit 1")
+	fs.BoolVar(&c.BaselineIgnorePath, "baseline-ignore-path", false, "Compare baseline entries by name and version only, ignoring the path")
+	fs.BoolVar(&c.UpdateBaseline, "update-baseline", false, "Write the current matches to the -baseline file, accepting them as known")
+	fs.BoolVar(&c.ValidateIOC, "validate-ioc", false, "Only check the IOC sources for malformed lines, duplicates and unparseable ranges; exit 2 if any are found, else 0")
+	fs.BoolVar(&c.Diff, "diff", false, "Compare two JSON reports given as arguments (old new) instead of scanning, listing added and removed matches (-format text, json or markdown); exit 1 if matches were added")
+	fs.BoolVar(&c.DryRun, "dry-run", false, "Only list the directories that would be scanned and whether they exist, then exit 0")
+	fs.BoolVar(&c.FailOnError, "fail-on-error", false, "Exit 3 if no matches were found, but files or directories could not be read or parsed")
+	fs.StringVar(&c.ExitCodeMap, "exit-code-map", "", "Override exit codes as outcome=code pairs, e.g. match=5,error=10,misconfig=0 (outcomes: ok, match, misconfig, unreadable, timeout, interrupted, error)")
+	fs.StringVar(&c.FailOn, "fail-on", "", "Only exit 1 if a match has at least this severity: low, medium, high or critical (matches without severity count as critical)")
+}
+
+// loadFile reads a config file into the fields whose flags were not set in
+// fs (from the command line), so flags take precedence over the file. The file is
+// a small YAML/TOML subset: one "key: value" or "key = value" per line,
+// where keys are flag names ("-" or "_" separated), values may be quoted,
+// and lists are written inline as [a, b] or as YAML "- item" lines below an
+// empty key. "#" starts a comment.
+func (c *Config) loadFile(path string, fs *flag.FlagSet) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open config file: %w", err)
+	}
+	defer file.Close()
+
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+	fields := c.fieldsByFlag()
+	c.fromFile = make(map[string]bool)
+
+	set := func(key, value string, lineNum int) error {
+		if explicit[key] {
+			return nil
+		}
+		if err := setField(fields[key], value); err != nil {
+			return fmt.Errorf("invalid value for %s at line %d: %w", key, lineNum, err)
+		}
+		c.fromFile[key] = true
+		return nil
+	}
+
+	var listKey string // key of an open YAML block list
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(stripComment(scanner.Text()))
+		if line == "" || line == "---" {
+			continue
+		}
+
+		if item, ok := strings.CutPrefix(line, "- "); ok && listKey != "" {
+			if err := set(listKey, unquote(strings.TrimSpace(item)), lineNum); err != nil {
+				return err
+			}
+			continue
+		}
+		listKey = ""
+
+		sep := strings.IndexAny(line, ":=")
+		if sep < 0 {
+			return fmt.Errorf("invalid config line %d: %s", lineNum, line)
+		}
+		key := strings.ReplaceAll(strings.TrimSpace(line[:sep]), "_", "-")
+		value := strings.TrimSpace(line[sep+1:])
+		field, ok := fields[key]
+		if !ok || key == "config" {
+			return fmt.Errorf("unknown config option at line %d: %s", lineNum, key)
+		}
+
+		switch {
+		case value == "":
+			if _, isList := field.Addr().Interface().(*stringList); !isList {
+				return fmt.Errorf("missing value for %s at line %d", key, lineNum)
+			}
+			listKey = key
+		case strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]"):
+			for _, item := range strings.Split(value[1:len(value)-1], ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					if err := set(key, unquote(item), lineNum); err != nil {
+						return err
+					}
+				}
+			}
+		default:
+			if err := set(key, unquote(value), lineNum); err != nil {
+				return err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	return nil
+}
+
+// isSet reports whether the named flag was given on the command line or
+// in the config file
+func (c *Config) isSet(name string) bool {
+	return isFlagSet(name) || c.fromFile[name]
+}
+
+// fieldsByFlag maps the flag names to the fields of c
+func (c *Config) fieldsByFlag() map[string]reflect.Value {
+	v := reflect.ValueOf(c).Elem()
+	fields := make(map[string]reflect.Value)
+	for i := 0; i < v.NumField(); i++ {
+		if name := v.Type().Field(i).Tag.Get("flag"); name != "" {
+			fields[name] = v.Field(i)
+		}
+	}
+	return fields
+}
+
+// setField parses value for the type of field and stores it; list values
+// are appended
+func setField(field reflect.Value, value string) error {
+	switch p := field.Addr().Interface().(type) {
+	case *string:
+		*p = value
+	case *bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean", value)
+		}
+		*p = b
+	case *int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", value)
+		}
+		*p = n
+	case *int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", value)
+		}
+		*p = n
+	case *time.Duration:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a duration", value)
+		}
+		*p = d
+	case *stringList:
+		*p = append(*p, value)
+	default:
+		return fmt.Errorf("unsupported option type %s", field.Type())
+	}
+	return nil
+}
+
+// stripComment removes a "#" comment that is not inside quotes
+func stripComment(line string) string {
+	var quote rune
+	for i, c := range line {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// unquote removes matching surrounding quotes from a value
+func unquote(value string) string {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
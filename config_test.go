@@ -0,0 +1,99 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// newTestConfig returns a Config with its flags defined in a new flag set,
+// parsed from args
+func newTestConfig(t *testing.T, args ...string) (*Config, *flag.FlagSet) {
+	t.Helper()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	var c Config
+	c.registerFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return &c, fs
+}
+
+// writeConfig writes a config file and returns its path
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "qs.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestConfigFieldsMatchFlags(t *testing.T) {
+	c, fs := newTestConfig(t)
+	fields := c.fieldsByFlag()
+	fs.VisitAll(func(f *flag.Flag) {
+		if _, ok := fields[f.Name]; !ok {
+			t.Errorf("flag -%s has no Config field", f.Name)
+		}
+	})
+	for name := range fields {
+		if fs.Lookup(name) == nil {
+			t.Errorf("Config field for %q has no flag", name)
+		}
+	}
+}
+
+func TestConfigLoadFile(t *testing.T) {
+	path := writeConfig(t, `# scanner settings
+format: json
+workers = 8
+timeout: "10m"
+global: false
+max_file_size: 1048576
+exclude: [dist, "**/.cache/**"]
+ioc:
+  - ioc.txt
+  - https://example.com/ioc.json
+`)
+	c, fs := newTestConfig(t, "-workers", "2", "-exclude", "build")
+	if err := c.loadFile(path, fs); err != nil {
+		t.Fatal(err)
+	}
+
+	if c.Format != "json" || c.Timeout != 10*time.Minute || c.Global || c.MaxFileSize != 1<<20 {
+		t.Errorf("format %q, timeout %v, global %v, max-file-size %d", c.Format, c.Timeout, c.Global, c.MaxFileSize)
+	}
+	if want := []string{"ioc.txt", "https://example.com/ioc.json"}; !slices.Equal(c.IOC, want) {
+		t.Errorf("ioc = %v, want %v", c.IOC, want)
+	}
+	// Flags given on the command line take precedence
+	if c.Workers != 2 || !slices.Equal(c.Exclude, []string{"build"}) {
+		t.Errorf("workers %d, exclude %v, want the command-line values", c.Workers, c.Exclude)
+	}
+	if !c.isSet("global") || c.isSet("stream") {
+		t.Errorf("isSet(global) = %v, isSet(stream) = %v", c.isSet("global"), c.isSet("stream"))
+	}
+}
+
+func TestConfigLoadFileErrors(t *testing.T) {
+	for _, content := range []string{
+		"no separator\n",
+		"unknown-option: 1\n",
+		"config: other.yaml\n",
+		"workers: many\n",
+		"global: maybe\n",
+		"timeout: 10\n",
+		"format:\n  - json\n",
+	} {
+		c, fs := newTestConfig(t)
+		if err := c.loadFile(writeConfig(t, content), fs); err == nil {
+			t.Errorf("config %q loaded without error", content)
+		}
+	}
+}
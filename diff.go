@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/cschneider4711/quick-npm-module-scanner/scanner"
+)
+
+// isValidDiffFormat reports whether the given format is supported by -diff
+func isValidDiffFormat(format string) bool {
+	switch format {
+	case "text", "json", "markdown":
+		return true
+	}
+	return false
+}
+
+// jsonDiff is the top-level object of the JSON diff report
+type jsonDiff struct {
+	Added   []scanner.Match `json:"added"`
+	Removed []scanner.Match `json:"removed"`
+}
+
+// writeDiff writes the matches added and removed between two reports
+func writeDiff(w io.Writer, format string, added, removed []scanner.Match) error {
+	switch format {
+	case "json":
+		report := jsonDiff{Added: added, Removed: removed}
+		if report.Added == nil {
+			report.Added = []scanner.Match{}
+		}
+		if report.Removed == nil {
+			report.Removed = []scanner.Match{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	case "markdown":
+		var b strings.Builder
+		if len(added) == 0 && len(removed) == 0 {
+			b.WriteString("No changes in IOC matches\n")
+		} else {
+			b.WriteString("| Change | Package | Version | Path |\n")
+			b.WriteString("| --- | --- | --- | --- |\n")
+			for _, change := range []struct {
+				label   string
+				matches []scanner.Match
+			}{{"added", added}, {"removed", removed}} {
+				for _, m := range change.matches {
+					fmt.Fprintf(&b, "| %s | %s | %s | %s |\n", change.label, markdownEscaper.Replace(m.Name),
+						markdownEscaper.Replace(m.Version), markdownEscaper.Replace(m.Path))
+				}
+			}
+		}
+		fmt.Fprintf(&b, "\n%s added, %s removed\n", plural(len(added), "match"), plural(len(removed), "match"))
+		_, err := io.WriteString(w, b.String())
+		return err
+	default:
+		for _, m := range added {
+			if _, err := fmt.Fprintf(w, "+ %s@%s: %s\n", m.Name, m.Version, m.Path); err != nil {
+				return err
+			}
+		}
+		for _, m := range removed {
+			if _, err := fmt.Fprintf(w, "- %s@%s: %s\n", m.Name, m.Version, m.Path); err != nil {
+				return err
+			}
+		}
+		_, err := fmt.Fprintf(w, "%s added, %s removed\n", plural(len(added), "match"), plural(len(removed), "match"))
+		return err
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Outcomes of a run, as named in -exit-code-map
+const (
+	exitOK          = "ok"          // no (failing) matches found
+	exitMatch       = "match"       // matches found, or added in a -diff
+	exitMisconfig   = "misconfig"   // no scan due to misconfiguration
+	exitUnreadable  = "unreadable"  // no matches, but unreadable files with -fail-on-error
+	exitTimeout     = "timeout"     // -timeout expired
+	exitInterrupted = "interrupted" // interrupted by a signal
+	exitError       = "error"       // any other error
+)
+
+// exitCodes maps each outcome to its exit code; -exit-code-map overrides
+// the defaults
+var exitCodes = map[string]int{
+	exitOK:          0,
+	exitMatch:       1,
+	exitMisconfig:   2,
+	exitUnreadable:  3,
+	exitTimeout:     124,
+	exitInterrupted: 130,
+	exitError:       -1,
+}
+
+// parseExitCodeMap applies "outcome=code" pairs (e.g. "match=5,error=10")
+// to exitCodes. Codes must be in the range 0-255 the shell can see.
+func parseExitCodeMap(spec string) error {
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		outcome, value, ok := strings.Cut(pair, "=")
+		outcome = strings.TrimSpace(outcome)
+		if !ok {
+			return fmt.Errorf("%q is not outcome=code", pair)
+		}
+		if _, known := exitCodes[outcome]; !known {
+			return fmt.Errorf("unknown outcome %q (ok, match, misconfig, unreadable, timeout, interrupted or error)", outcome)
+		}
+		code, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || code < 0 || code > 255 {
+			return fmt.Errorf("invalid exit code %q for %s (0-255)", value, outcome)
+		}
+		exitCodes[outcome] = code
+	}
+	return nil
+}
+
+// exit terminates the program with the exit code of an outcome
+func exit(outcome string) {
+	os.Exit(exitCodes[outcome])
+}
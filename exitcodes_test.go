@@ -0,0 +1,38 @@
+package main
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestParseExitCodeMap(t *testing.T) {
+	defaults := maps.Clone(exitCodes)
+	t.Cleanup(func() { exitCodes = defaults })
+
+	if err := parseExitCodeMap(" match=5, error = 10,,misconfig=0"); err != nil {
+		t.Fatal(err)
+	}
+	want := maps.Clone(defaults)
+	want[exitMatch], want[exitError], want[exitMisconfig] = 5, 10, 0
+	if !maps.Equal(exitCodes, want) {
+		t.Errorf("exit codes = %v, want %v", exitCodes, want)
+	}
+}
+
+func TestParseExitCodeMapErrors(t *testing.T) {
+	defaults := maps.Clone(exitCodes)
+	t.Cleanup(func() { exitCodes = defaults })
+
+	for _, spec := range []string{
+		"match",
+		"found=1",
+		"match=",
+		"match=x",
+		"match=-1",
+		"match=256",
+	} {
+		if err := parseExitCodeMap(spec); err == nil {
+			t.Errorf("parseExitCodeMap(%q) succeeded", spec)
+		}
+	}
+}
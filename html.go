@@ -0,0 +1,178 @@
+package main
+
+import (
+	"html/template"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/cschneider4711/quick-npm-module-scanner/scanner"
+)
+
+// htmlTemplate renders a self-contained report; html/template escapes all
+// package names, versions and paths, so they cannot inject markup
+var htmlTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"details": htmlDetails,
+	"severity": func(m scanner.Match) string {
+		if m.Severity == "" {
+			return "critical"
+		}
+		return strings.ToLower(m.Severity)
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>npm module scan report</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 1.5em; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; vertical-align: top; }
+th { background: #f0f0f0; }
+td.path { font-family: monospace; word-break: break-all; }
+.sev-critical { background: #f8d0d0; }
+.sev-high { background: #fbe0c8; }
+.sev-medium, .sev-moderate { background: #fdf3c4; }
+.sev-low { background: #e0ecf8; }
+.known { color: #777; }
+.ok { color: #2a7a2a; }
+</style>
+</head>
+<body>
+<h1>npm module scan report</h1>
+<p>Generated {{.Generated}}</p>
+
+<h2>Summary</h2>
+<table>
+<tr><th>Scan roots</th><td>{{.Stats.Roots}}</td></tr>
+<tr><th>package.json files</th><td>{{.Stats.PackageFiles}}</td></tr>
+<tr><th>Packages parsed</th><td>{{.Stats.Packages}}</td></tr>
+<tr><th>Lockfiles parsed</th><td>{{.Stats.Lockfiles}}</td></tr>
+<tr><th>Parse failures</th><td>{{.Stats.ParseErrors}}</td></tr>
+<tr><th>Inaccessible paths</th><td>{{.Stats.WalkErrors}}</td></tr>
+<tr><th>Matches</th><td>{{.MatchCount}}</td></tr>
+<tr><th>Elapsed</th><td>{{.Elapsed}}</td></tr>
+</table>
+
+<h2>{{if .Inventory}}Packages{{else}}Matches{{end}}</h2>
+{{- range .Groups}}
+<h3>{{.Root}} ({{.Count}})</h3>
+<table>
+<tr><th>Package</th><th>Version</th><th>Severity</th><th>Path</th><th>Details</th></tr>
+{{- range .Matches}}
+<tr{{if .Baselined}} class="known"{{else if .IOCMatched}} class="sev-{{severity .}}"{{end}}>
+<td>{{.Name}}</td><td>{{.Version}}</td>
+<td>{{if .IOCMatched}}{{severity .}}{{if .Baselined}} (known){{end}}{{end}}</td>
+<td class="path">{{.Path}}</td>
+<td>{{details .}}</td>
+</tr>
+{{- end}}
+</table>
+{{- else}}
+<p class="ok">No IOC matches found.</p>
+{{- end}}
+
+{{- if .Suspicious}}
+<h2>Packages with install scripts</h2>
+<table>
+<tr><th>Package</th><th>Version</th><th>Path</th><th>Scripts</th></tr>
+{{- range .Suspicious}}
+<tr><td>{{.Name}}</td><td>{{.Version}}</td><td class="path">{{.Path}}</td><td>{{range .InstallScripts}}<div>{{.}}</div>{{end}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+
+{{- if .Unattested}}
+<h2>Packages without provenance (weak signal)</h2>
+<table>
+<tr><th>Package</th><th>Version</th><th>Path</th></tr>
+{{- range .Unattested}}
+<tr><td>{{.Name}}</td><td>{{.Version}}</td><td class="path">{{.Path}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+
+{{- if .Scored}}
+<h2>Suspicious packages by score</h2>
+<table>
+<tr><th>Score</th><th>Package</th><th>Version</th><th>Path</th><th>Signals</th></tr>
+{{- range .Scored}}
+<tr><td>{{.Score}}</td><td>{{.Name}}</td><td>{{.Version}}</td><td class="path">{{.Path}}</td><td>{{range .ScoreReasons}}<div>{{.}}</div>{{end}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+
+{{- if .Modified}}
+<h2>Packages modified after install</h2>
+<table>
+<tr><th>Package</th><th>Version</th><th>Newest file</th><th>Modified</th></tr>
+{{- range .Modified}}
+<tr><td>{{.Name}}</td><td>{{.Version}}</td><td class="path">{{.ModifiedFile}}</td><td>{{.ModifiedAt.Format "2006-01-02 15:04:05"}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+
+{{- if .Writable}}
+<h2>Writable by group or others (hardening)</h2>
+<table>
+<tr><th>Mode</th><th>Path</th></tr>
+{{- range .Writable}}
+<tr><td>{{.Mode}}</td><td class="path">{{.Path}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+
+{{- if .Duplicates}}
+<h2>Packages installed at several versions</h2>
+<table>
+<tr><th>Package</th><th>Version</th><th>Paths</th></tr>
+{{- range .Duplicates}}{{$name := .Name}}
+{{- range .Versions}}
+<tr><td>{{$name}}</td><td>{{.Version}}</td><td class="path">{{range .Paths}}<div>{{.}}</div>{{end}}</td></tr>
+{{- end}}
+{{- end}}
+</table>
+{{- end}}
+</body>
+</html>
+`))
+
+// htmlDetails describes where a match comes from: its source if not an
+// installed package, the IOC rule if not exact, the IOC reason and the
+// dependency chain
+func htmlDetails(m scanner.Match) string {
+	var details []string
+	if m.Source != scanner.SourceInstalled {
+		details = append(details, m.Source)
+	}
+	if showRule(m) {
+		details = append(details, "rule "+m.MatchedRule)
+	}
+	if m.Reason != "" {
+		details = append(details, m.Reason)
+	}
+	if len(m.Chain) > 1 {
+		details = append(details, "via "+strings.Join(m.Chain, " > "))
+	}
+	return strings.Join(details, "; ")
+}
+
+// writeHTML writes the report as a standalone HTML page, with matches
+// grouped by scan root and colored by severity
+func writeHTML(w io.Writer, data reportData) error {
+	return htmlTemplate.Execute(w, struct {
+		reportData
+		Generated  string
+		Groups     []rootGroup
+		Inventory  bool
+		MatchCount int
+		Elapsed    time.Duration
+	}{
+		reportData: data,
+		Generated:  time.Now().Format(time.RFC1123),
+		Groups:     groupByRoot(data.Matches),
+		Inventory:  !allIOCMatches(data.Matches),
+		MatchCount: countIOCMatches(data.Matches),
+		Elapsed:    data.Stats.Elapsed.Round(time.Millisecond),
+	})
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// plainHandler is a slog.Handler that keeps the scanner's traditional
+// human-readable output: debug and info messages are printed as they are,
+// warnings and errors with a "Warning: " or "Error: " prefix to a separate
+// writer. Attributes are appended as key=value pairs.
+type plainHandler struct {
+	level slog.Leveler
+	out   io.Writer // debug and info messages
+	err   io.Writer // warnings and errors
+	attrs []slog.Attr
+	mu    *sync.Mutex
+
+	// colorWarnings prints warnings and errors in yellow
+	colorWarnings bool
+}
+
+func newPlainHandler(out, err io.Writer, level slog.Leveler) *plainHandler {
+	return &plainHandler{level: level, out: out, err: err, mu: &sync.Mutex{}}
+}
+
+func (h *plainHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *plainHandler) Handle(_ context.Context, r slog.Record) error {
+	var b strings.Builder
+	w := h.out
+	switch {
+	case r.Level >= slog.LevelError:
+		b.WriteString("Error: ")
+		w = h.err
+	case r.Level >= slog.LevelWarn:
+		b.WriteString("Warning: ")
+		w = h.err
+	case r.Level < slog.LevelInfo:
+		b.WriteString("Debug: ")
+	}
+	b.WriteString(r.Message)
+
+	writeAttr := func(a slog.Attr) bool {
+		fmt.Fprintf(&b, " %s=%v", a.Key, a.Value)
+		return true
+	}
+	for _, a := range h.attrs {
+		writeAttr(a)
+	}
+	r.Attrs(writeAttr)
+	line := b.String()
+	if h.colorWarnings && r.Level >= slog.LevelWarn {
+		line = paint(colorYellow, line)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(w, line+"\n")
+	return err
+}
+
+func (h *plainHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *h
+	clone.attrs = append(h.attrs[:len(h.attrs):len(h.attrs)], attrs...)
+	return &clone
+}
+
+// WithGroup is a no-op; the scanner does not use attribute groups
+func (h *plainHandler) WithGroup(string) slog.Handler {
+	return h
+}
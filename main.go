@@ -1,329 +1,781 @@
 package main
 
 import (
-	"bufio"
-	"encoding/json"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"log/slog"
 	"os"
+	"os/signal"
+	"path"
 	"path/filepath"
-	"regexp"
 	"runtime"
 	"strings"
+	"syscall"
+	"time"
+
+	"github.com/cschneider4711/quick-npm-module-scanner/scanner"
 )
 
-// PackageJSON represents the minimal structure we need from package.json
-type PackageJSON struct {
-	Name    string `json:"name"`
-	Version string `json:"version"`
+// Version is set at build time via -ldflags "-X main.Version=..."
+var Version = "dev"
+
+// logOut receives informational output; it is switched to stderr for
+// machine-readable formats so stdout only carries the report
+var logOut io.Writer = os.Stdout
+
+// logger receives all log output; it is configured from -log-level and
+// -log-format once the flags are parsed
+var logger = slog.New(newPlainHandler(logOut, os.Stderr, slog.LevelInfo))
+
+// logf logs an informational message
+func logf(format string, args ...any) {
+	logger.Info(strings.TrimSpace(fmt.Sprintf(format, args...)))
 }
 
-// loadIOCs reads the IOC file and returns a map of package entries (name,version -> true)
-func loadIOCs(iocPath string) (map[string]bool, error) {
-	file, err := os.Open(iocPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open IOC file: %w", err)
-	}
-	defer file.Close()
+// warnf logs a warning
+func warnf(format string, args ...any) {
+	logger.Warn(strings.TrimSpace(fmt.Sprintf(format, args...)))
+}
 
-	iocs := make(map[string]bool)
-	scanner := bufio.NewScanner(file)
-	lineNum := 0
-	for scanner.Scan() {
-		lineNum++
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" {
-			continue
-		}
+// stringList is a flag.Value collecting repeated flag values
+type stringList []string
 
-		// Parse format: package-name,version
-		parts := strings.Split(line, ",")
-		if len(parts) != 2 {
-			fmt.Fprintf(os.Stderr, "Warning: invalid format at line %d: %s\n", lineNum, line)
-			continue
-		}
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
 
-		name := strings.TrimSpace(parts[0])
-		version := strings.TrimSpace(parts[1])
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
 
-		if name == "" || version == "" {
-			fmt.Fprintf(os.Stderr, "Warning: empty name or version at line %d: %s\n", lineNum, line)
-			continue
+// isFlagSet reports whether the named flag was given on the command line
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
 		}
+	})
+	return set
+}
 
-		// Store as "name,version" key for easy lookup
-		key := fmt.Sprintf("%s,%s", name, version)
-		iocs[key] = true
+// markBaselined flags the IOC matches listed in the baseline
+func markBaselined(matches []scanner.Match, baseline *scanner.Baseline) {
+	if baseline == nil {
+		return
 	}
-
-	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("failed to read IOC file: %w", err)
+	for i := range matches {
+		if matches[i].IOCMatched && baseline.Contains(matches[i]) {
+			matches[i].Baselined = true
+		}
 	}
-
-	return iocs, nil
 }
 
-// expandEnvVars expands environment variables in a path
-// Supports both %VAR% (Windows) and $VAR or ${VAR} (Unix) syntax
-func expandEnvVars(path string) string {
-	// First expand Unix-style variables using os.ExpandEnv
-	result := os.ExpandEnv(path)
+// errFirstMatch cancels the scan with -stop-on-first-match
+var errFirstMatch = errors.New("stopped at the first match")
 
-	// Then expand Windows-style %VAR% variables
-	re := regexp.MustCompile(`%([^%]+)%`)
-	result = re.ReplaceAllStringFunc(result, func(match string) string {
-		varName := strings.Trim(match, "%")
-		if val := os.Getenv(varName); val != "" {
-			return val
+// hasFailingMatch reports whether any match should fail the run. Baselined
+// matches never fail it. Without a threshold every other match fails;
+// otherwise only those meeting the severity.
+func hasFailingMatch(matches []scanner.Match, failOn string) bool {
+	for _, m := range matches {
+		if m.Baselined {
+			continue
 		}
-		return match // Keep original if not found
-	})
+		if failOn == "" || scanner.MeetsSeverity(m.Severity, failOn) {
+			return true
+		}
+	}
+	return false
+}
 
-	return result
+// parseDate parses a date given on the command line, as a day (local
+// midnight) or an RFC 3339 timestamp
+func parseDate(s string) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
 }
 
-// expandGlobPath expands glob patterns in a path and returns all matching paths
-func expandGlobPath(path string) []string {
-	// First expand environment variables
-	expandedPath := expandEnvVars(path)
+// collectScanDirs resolves the scan roots: the paths files (or the default
+// paths, if none of them can be read) if scanGlobal is set, plus the
+// glob-expanded arguments and, with workspaces set, the workspaces they
+// declare, without duplicates or roots that walking another root with the
+// settings in walk covers. Relative paths are resolved against baseDir, if
+// set.
+func collectScanDirs(scanGlobal bool, pathsFiles []string, args []string, workspaces bool, baseDir string, walk scanner.Options) []string {
+	var dirsToScan []string
 
-	// Clean the path (normalize separators)
-	expandedPath = filepath.Clean(expandedPath)
+	// Add directories from paths files if requested
+	if scanGlobal {
+		loaded := 0
+		for _, pathsFile := range pathsFiles {
+			paths, err := scanner.LoadPathsFromFileIn(pathsFile, baseDir)
+			source := pathsFile
+			if source == "-" {
+				source = "stdin"
+			}
+			if err != nil {
+				warnf("Could not load paths from %s: %v\n", source, err)
+				continue
+			}
+			logf("Loaded %d paths from %s\n", len(paths), source)
+			dirsToScan = append(dirsToScan, paths...)
+			loaded++
+		}
+		if loaded == 0 {
+			logf("Using default paths...\n")
+			dirsToScan = append(dirsToScan, scanner.DefaultPaths()...)
+		}
+	}
 
-	// Check if path contains glob patterns
-	if !strings.Contains(expandedPath, "*") && !strings.Contains(expandedPath, "?") {
-		return []string{expandedPath}
+	// Add additional directories from command-line arguments
+	for _, p := range args {
+		expanded := scanner.ExpandGlobPathIn(p, baseDir)
+		dirsToScan = append(dirsToScan, expanded...)
 	}
 
-	// Use filepath.Glob to expand
-	matches, err := filepath.Glob(expandedPath)
-	if err != nil || len(matches) == 0 {
-		// Return original path if glob fails or no matches
-		return []string{expandedPath}
+	// Add the workspaces of monorepo roots
+	if workspaces {
+		for _, dir := range dirsToScan {
+			if found := scanner.WorkspaceRoots(dir); len(found) > 0 {
+				logf("Found %d workspaces in %s\n", len(found), dir)
+				dirsToScan = append(dirsToScan, found...)
+			}
+		}
 	}
 
-	return matches
-}
+	// Remove duplicates, however the paths were spelled
+	seen := make(map[string]bool)
+	var uniqueDirs []string
+	for _, dir := range dirsToScan {
+		dir = scanner.AbsPath(dir)
+		if !seen[dir] {
+			seen[dir] = true
+			uniqueDirs = append(uniqueDirs, dir)
+		}
+	}
+	dirsToScan = uniqueDirs
 
-// isPathForCurrentOS checks if a path is intended for the current OS
-func isPathForCurrentOS(path string) bool {
-	isWindows := runtime.GOOS == "windows"
+	// Drop roots already covered by walking another root
+	if nonNested := scanner.DropNestedRoots(dirsToScan, walk); len(nonNested) < len(dirsToScan) {
+		logf("Skipping %d scan roots nested inside or the same as other roots\n", len(dirsToScan)-len(nonNested))
+		dirsToScan = nonNested
+	}
+	return dirsToScan
+}
 
-	// Check for definitive OS-specific patterns
-	// Leading "/" is a definitive Unix absolute path indicator
-	isDefinitelyUnix := strings.HasPrefix(path, "/")
+func main() {
+	var cfg Config
+	cfg.registerFlags(flag.CommandLine)
+	flag.Parse()
 
-	// Drive letter (e.g., "C:") is a definitive Windows path indicator
-	isDefinitelyWindows := len(path) >= 2 && path[1] == ':'
+	// Precedence: defaults < config file < command-line flags
+	if cfg.ConfigFile != "" {
+		if err := cfg.loadFile(cfg.ConfigFile, flag.CommandLine); err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+			exit(exitMisconfig)
+		}
+	}
 
-	// Definitive indicators take priority - reject paths clearly meant for other OS
-	if isWindows {
-		// On Windows, reject paths that definitively start with Unix root
-		if isDefinitelyUnix {
-			return false
+	if cfg.ExitCodeMap != "" {
+		if err := parseExitCodeMap(cfg.ExitCodeMap); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid -exit-code-map: %v\n", err)
+			exit(exitMisconfig)
 		}
-		// Accept Windows paths or ambiguous paths (relative, env vars only, etc.)
-		return true
 	}
 
-	// On Unix, reject paths that have Windows drive letters
-	if isDefinitelyWindows {
-		return false
+	// Explicit path arguments mean a targeted scan: the paths file and the
+	// default system-wide paths are only added if -global is given as well
+	if flag.NArg() > 0 && !cfg.isSet("global") {
+		cfg.Global = false
 	}
-	// Accept Unix paths or ambiguous paths
-	return true
-}
 
-// loadPathsFromFile reads scan paths from a file
-func loadPathsFromFile(pathsFile string) ([]string, error) {
-	file, err := os.Open(pathsFile)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open paths file: %w", err)
+	if cfg.FailOn != "" && !scanner.ValidSeverity(cfg.FailOn) {
+		fmt.Fprintf(os.Stderr, "Error: invalid -fail-on severity: %s\n", cfg.FailOn)
+		exit(exitMisconfig)
 	}
-	defer file.Close()
 
-	var paths []string
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
+	if len(cfg.Paths) == 0 {
+		cfg.Paths = stringList{"paths.txt"}
+	}
 
-		// Skip empty lines and comments
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
+	for _, pattern := range cfg.Include {
+		if _, err := path.Match(pattern, ""); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid -include pattern %q: %v\n", pattern, err)
+			exit(exitMisconfig)
 		}
+	}
 
-		// Skip paths not intended for current OS
-		if !isPathForCurrentOS(line) {
-			continue
+	var modifiedAfterTime time.Time
+	if cfg.ModifiedAfter != "" {
+		var err error
+		if modifiedAfterTime, err = parseDate(cfg.ModifiedAfter); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid -modified-after date: %s\n", cfg.ModifiedAfter)
+			exit(exitMisconfig)
 		}
+		cfg.MtimeCheck = true
+	}
 
-		// Expand glob patterns (which also expands env vars)
-		expandedPaths := expandGlobPath(line)
-		paths = append(paths, expandedPaths...)
+	var newerThanTime time.Time
+	if cfg.NewerThan != "" {
+		var err error
+		if newerThanTime, err = parseDate(cfg.NewerThan); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid -newer-than date: %s\n", cfg.NewerThan)
+			exit(exitMisconfig)
+		}
 	}
 
-	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("failed to read paths file: %w", err)
+	var baseDir string
+	if cfg.BaseDir != "" {
+		var err error
+		baseDir, err = filepath.Abs(cfg.BaseDir)
+		if err == nil {
+			var info os.FileInfo
+			if info, err = os.Stat(baseDir); err == nil && !info.IsDir() {
+				err = errors.New("not a directory")
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid -base-dir %s: %v\n", cfg.BaseDir, err)
+			exit(exitMisconfig)
+		}
 	}
 
-	return paths, nil
-}
+	if cfg.RelativePaths && cfg.RelativeTo != "" {
+		fmt.Fprintf(os.Stderr, "Error: -relative-paths and -relative-to cannot be combined\n")
+		exit(exitMisconfig)
+	}
 
-// getDefaultPaths returns fallback paths if no paths file is found
-func getDefaultPaths() []string {
-	dirs := []string{
-		"/usr/local/lib/node_modules",
-		"/opt/homebrew/lib/node_modules",
+	if cfg.CheckPerms && runtime.GOOS == "windows" {
+		warnf("-check-perms is not supported on Windows, whose ACLs the permission bits do not reflect\n")
 	}
 
-	// Add Homebrew Intel Cellar paths using glob expansion
-	cellarPaths, err := filepath.Glob("/usr/local/Cellar/node/*/lib/node_modules")
-	if err == nil {
-		dirs = append(dirs, cellarPaths...)
+	if cfg.SummaryOnly && !isValidSummaryFormat(cfg.Format) {
+		fmt.Fprintf(os.Stderr, "Error: -summary-only supports the formats text, json, ndjson and markdown, not %s\n", cfg.Format)
+		exit(exitMisconfig)
 	}
 
-	return dirs
-}
+	if cfg.Resume && cfg.Checkpoint == "" {
+		fmt.Fprintf(os.Stderr, "Error: -resume requires -checkpoint\n")
+		exit(exitMisconfig)
+	}
 
-// scanDirectory recursively walks a directory and checks for IOC matches
-func scanDirectory(dirPath string, iocs map[string]bool) ([]string, error) {
-	var matches []string
+	if cfg.UpdateBaseline && cfg.Baseline == "" {
+		fmt.Fprintf(os.Stderr, "Error: -update-baseline requires -baseline\n")
+		exit(exitMisconfig)
+	}
 
-	err := filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			// Skip directories that we can't access
-			return nil
-		}
+	if !isValidFormat(cfg.Format) {
+		fmt.Fprintf(os.Stderr, "Error: unsupported output format: %s\n", cfg.Format)
+		exit(exitMisconfig)
+	}
 
-		// Look for package.json files in node_modules
-		if info.IsDir() || info.Name() != "package.json" {
-			return nil
-		}
+	// An SBOM lists every package, not just matches
+	if cfg.Format == "cyclonedx" {
+		cfg.Inventory = true
+	}
 
-		// Check if this is in a node_modules directory
-		if !strings.Contains(path, "node_modules") {
-			return nil
-		}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.LogLevel)); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid -log-level: %s\n", cfg.LogLevel)
+		exit(exitMisconfig)
+	}
+	if cfg.Quiet {
+		level = max(level, slog.LevelWarn)
+	}
 
-		// Read and parse package.json
-		file, err := os.Open(path)
+	// Keep stdout clean for machine-readable formats and structured logs
+	if cfg.Format != "text" || cfg.LogFormat == "json" {
+		logOut = os.Stderr
+	}
+	colorStdout := !cfg.NoColor && useColor(os.Stdout)
+	switch cfg.LogFormat {
+	case "text":
+		handler := newPlainHandler(logOut, os.Stderr, level)
+		handler.colorWarnings = !cfg.NoColor && useColor(os.Stderr)
+		logger = slog.New(handler)
+	case "json":
+		logger = slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unsupported log format: %s\n", cfg.LogFormat)
+		exit(exitMisconfig)
+	}
+	scanner.Logger = logger
+
+	// Open the report destination up front so a bad path fails before scanning
+	var reportOut io.Writer = os.Stdout
+	var reportFile *os.File
+	if cfg.Output != "" {
+		var err error
+		reportFile, err = os.Create(cfg.Output)
 		if err != nil {
-			return nil
+			fmt.Fprintf(os.Stderr, "Error creating output file: %v\n", err)
+			exit(exitError)
 		}
-		defer file.Close()
+		reportOut = reportFile
+	}
+	// Only the text report on a terminal is colored, never JSON or SARIF
+	colorReport = colorStdout && reportFile == nil && cfg.Format == "text"
 
-		data, err := io.ReadAll(file)
-		if err != nil {
-			return nil
+	if cfg.IOCRetries < 0 {
+		fmt.Fprintf(os.Stderr, "Error: invalid -ioc-retries: %d\n", cfg.IOCRetries)
+		exit(exitMisconfig)
+	}
+	fetchOpts := scanner.FetchOptions{
+		Timeout:  cfg.IOCTimeout,
+		Retries:  cfg.IOCRetries,
+		Backoff:  cfg.IOCRetryBackoff,
+		CacheDir: cfg.IOCCache,
+		CacheTTL: cfg.IOCCacheTTL,
+	}
+
+	var sources []string
+	for _, source := range cfg.IOC {
+		for _, s := range strings.Split(source, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				sources = append(sources, s)
+			}
 		}
+	}
+	if len(sources) == 0 {
+		sources = []string{"ioc.txt"}
+	}
 
-		var pkg PackageJSON
-		if err := json.Unmarshal(data, &pkg); err != nil {
-			return nil
+	// A pinned hash identifies one file, so it cannot apply to several
+	iocOpts := fetchOpts
+	if cfg.IOCSHA256 != "" {
+		if sum, err := hex.DecodeString(cfg.IOCSHA256); err != nil || len(sum) != sha256.Size {
+			fmt.Fprintf(os.Stderr, "Error: invalid -ioc-sha256 hash: %s\n", cfg.IOCSHA256)
+			exit(exitMisconfig)
+		}
+		if len(sources) > 1 {
+			fmt.Fprintf(os.Stderr, "Error: -ioc-sha256 requires a single IOC source, got %d\n", len(sources))
+			exit(exitMisconfig)
 		}
+		iocOpts.SHA256 = cfg.IOCSHA256
+	}
 
-		// Check if package name and version matches any IOC
-		if pkg.Name != "" && pkg.Version != "" {
-			key := fmt.Sprintf("%s,%s", pkg.Name, pkg.Version)
-			if iocs[key] {
-				packageDir := filepath.Dir(path)
-				matches = append(matches, fmt.Sprintf("[MATCH] %s@%s: %s", pkg.Name, pkg.Version, packageDir))
+	// Validation only lints the IOC sources, without scanning
+	if cfg.ValidateIOC {
+		problems := 0
+		for _, source := range sources {
+			report, err := scanner.ValidateIOCSource(source, iocOpts)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error loading IOCs from %s: %v\n", source, err)
+				exit(exitMisconfig)
 			}
+			if err := writeIOCReport(reportOut, source, report); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing results: %v\n", err)
+				exit(exitError)
+			}
+			problems += report.Problems()
 		}
-
-		return nil
-	})
-
-	if err != nil {
-		return matches, err
+		if problems > 0 {
+			exit(exitMisconfig)
+		}
+		exit(exitOK)
 	}
 
-	return matches, nil
-}
-
-func main() {
-	// Define command-line flags
-	iocPath := flag.String("ioc", "ioc.txt", "Path to IOC file")
-	pathsFile := flag.String("paths", "paths.txt", "Path to file containing scan paths")
-	scanGlobal := flag.Bool("global", true, "Scan paths from paths file (or default paths if file not found)")
-	flag.Parse()
+	// A diff only compares two earlier reports, without scanning
+	if cfg.Diff {
+		if flag.NArg() != 2 {
+			fmt.Fprintf(os.Stderr, "Error: -diff requires two JSON report files (old new)\n")
+			exit(exitMisconfig)
+		}
+		if !isValidDiffFormat(cfg.Format) {
+			fmt.Fprintf(os.Stderr, "Error: unsupported -diff format: %s (text, json or markdown)\n", cfg.Format)
+			exit(exitMisconfig)
+		}
+		older, err := scanner.LoadReportMatches(flag.Arg(0))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(exitMisconfig)
+		}
+		newer, err := scanner.LoadReportMatches(flag.Arg(1))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(exitMisconfig)
+		}
+		added, removed := scanner.DiffMatches(older, newer)
+		if err := writeDiff(reportOut, cfg.Format, added, removed); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing results: %v\n", err)
+			exit(exitError)
+		}
+		if len(added) > 0 {
+			exit(exitMatch)
+		}
+		exit(exitOK)
+	}
 
-	fmt.Println("Exit codes: 0 = no matches found, 1 = matches found, 2 = no scan due to misconfiguration, -1 = error")
+	// The walk settings decide which nested roots other roots cover
+	walkOpts := scanner.Options{Exclude: cfg.Exclude, MaxDepth: cfg.MaxDepth, ScanHidden: cfg.ScanHidden, FollowSymlinks: cfg.FollowSymlinks}
 
-	// Load IOCs
-	iocs, err := loadIOCs(*iocPath)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error loading IOCs: %v\n", err)
-		os.Exit(2)
+	// A dry run only resolves the scan roots; it needs no IOCs
+	if cfg.DryRun {
+		if err := writeDryRun(reportOut, collectScanDirs(cfg.Global, cfg.Paths, flag.Args(), cfg.Workspaces, baseDir, walkOpts)); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing results: %v\n", err)
+			exit(exitError)
+		}
+		exit(exitOK)
 	}
 
-	fmt.Printf("Loaded %d IOCs from %s\n", len(iocs), *iocPath)
-
-	// Collect directories to scan
-	var dirsToScan []string
+	extraCodes := ""
+	if cfg.FailOnError {
+		extraCodes = fmt.Sprintf(", %d = no matches found, but files could not be read or parsed", exitCodes[exitUnreadable])
+	}
+	if cfg.Timeout > 0 {
+		extraCodes += fmt.Sprintf(", %d = timed out", exitCodes[exitTimeout])
+	}
+	if cfg.FailOn != "" {
+		logf("Exit codes: %d = no matches with severity %s or above found, %d = such matches found, %d = no scan due to misconfiguration%s, %d = interrupted, %d = error\n",
+			exitCodes[exitOK], cfg.FailOn, exitCodes[exitMatch], exitCodes[exitMisconfig], extraCodes, exitCodes[exitInterrupted], exitCodes[exitError])
+	} else {
+		logf("Exit codes: %d = no matches found, %d = matches found, %d = no scan due to misconfiguration%s, %d = interrupted, %d = error\n",
+			exitCodes[exitOK], exitCodes[exitMatch], exitCodes[exitMisconfig], extraCodes, exitCodes[exitInterrupted], exitCodes[exitError])
+	}
 
-	// Add directories from paths file if requested
-	if *scanGlobal {
-		paths, err := loadPathsFromFile(*pathsFile)
+	// Load and merge IOCs from all sources
+	var iocs *scanner.IOCSet
+	for _, source := range sources {
+		set, err := scanner.LoadIOCSource(source, iocOpts)
 		if err != nil {
-			fmt.Printf("Warning: Could not load paths from %s: %v\n", *pathsFile, err)
-			fmt.Println("Using default paths...")
-			dirsToScan = append(dirsToScan, getDefaultPaths()...)
+			fmt.Fprintf(os.Stderr, "Error loading IOCs from %s: %v\n", source, err)
+			exit(exitMisconfig)
+		}
+		logf("Loaded %d IOCs from %s\n", set.Len(), source)
+		if iocs == nil {
+			iocs = set
 		} else {
-			fmt.Printf("Loaded %d paths from %s\n", len(paths), *pathsFile)
-			dirsToScan = append(dirsToScan, paths...)
+			iocs.Merge(set)
 		}
 	}
+	if len(sources) > 1 {
+		logf("Loaded %d distinct IOCs from %d sources\n", iocs.Len(), len(sources))
+	}
+	if cfg.IgnoreBuildMetadata {
+		iocs.IgnoreBuildMetadata()
+	}
+	if cfg.IgnoreNameCase {
+		iocs.IgnoreNameCase()
+	}
 
-	// Add additional directories from command-line arguments
-	additionalPaths := flag.Args()
-	for _, p := range additionalPaths {
-		expanded := expandGlobPath(p)
-		dirsToScan = append(dirsToScan, expanded...)
+	// Load the allowlist, which shares the IOC format
+	var allowlist *scanner.IOCSet
+	if cfg.Allowlist != "" {
+		var err error
+		allowlist, err = scanner.LoadIOCSource(cfg.Allowlist, fetchOpts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading allowlist: %v\n", err)
+			exit(exitMisconfig)
+		}
+		logf("Loaded %d allowlist entries from %s\n", allowlist.Len(), cfg.Allowlist)
+		if cfg.IgnoreBuildMetadata {
+			allowlist.IgnoreBuildMetadata()
+		}
+		if cfg.IgnoreNameCase {
+			allowlist.IgnoreNameCase()
+		}
 	}
 
-	// Remove duplicates
-	seen := make(map[string]bool)
-	var uniqueDirs []string
-	for _, dir := range dirsToScan {
-		if !seen[dir] {
-			seen[dir] = true
-			uniqueDirs = append(uniqueDirs, dir)
+	var contentRules []scanner.ContentRule
+	if cfg.ContentRules != "" {
+		var err error
+		contentRules, err = scanner.LoadContentRules(cfg.ContentRules)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading content rules: %v\n", err)
+			exit(exitMisconfig)
 		}
+		logf("Loaded %d content rules from %s\n", len(contentRules), cfg.ContentRules)
+	}
+
+	// Load the baseline, unless it is about to be (re)generated
+	var baseline *scanner.Baseline
+	if cfg.Baseline != "" && !cfg.UpdateBaseline {
+		var err error
+		baseline, err = scanner.LoadBaseline(cfg.Baseline, cfg.BaselineIgnorePath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading baseline: %v\n", err)
+			exit(exitMisconfig)
+		}
+		logf("Loaded %d baseline entries from %s\n", baseline.Len(), cfg.Baseline)
 	}
-	dirsToScan = uniqueDirs
 
+	dirsToScan := collectScanDirs(cfg.Global, cfg.Paths, flag.Args(), cfg.Workspaces, baseDir, walkOpts)
 	if len(dirsToScan) == 0 {
-		fmt.Println("No directories to scan. Use -global flag or provide paths as arguments.")
-		os.Exit(2)
+		logf("No directories to scan. Use -global flag or provide paths as arguments.\n")
+		exit(exitMisconfig)
+	}
+
+	// Resuming skips the roots an earlier run completed, reusing its matches;
+	// allRoots keeps them for reporting those matches
+	allRoots := dirsToScan
+	progressFile := &checkpoint{}
+	var restored []scanner.Match
+	resumedRoots := 0
+	if cfg.Resume {
+		var err error
+		progressFile, err = loadCheckpoint(cfg.Checkpoint)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading checkpoint: %v\n", err)
+			exit(exitMisconfig)
+		}
+		var remaining []string
+		for _, dir := range dirsToScan {
+			if !progressFile.completed(dir) {
+				remaining = append(remaining, dir)
+			}
+		}
+		if resumedRoots = len(dirsToScan) - len(remaining); resumedRoots > 0 {
+			logf("Resuming: skipping %d scan roots completed according to %s\n", resumedRoots, cfg.Checkpoint)
+		}
+		dirsToScan = remaining
+		restored = progressFile.matches()
 	}
 
 	// Scan each directory
-	var allMatches []string
-	for _, dir := range dirsToScan {
-		// Check if directory exists
-		if _, err := os.Stat(dir); os.IsNotExist(err) {
-			fmt.Printf("Skipping non-existent directory: %s\n", dir)
-			continue
+	opts := scanner.Options{
+		Roots:              dirsToScan,
+		IOCs:               iocs,
+		Workers:            cfg.Workers,
+		Exclude:            cfg.Exclude,
+		Include:            cfg.Include,
+		MaxDepth:           cfg.MaxDepth,
+		Inventory:          cfg.Inventory || cfg.ReportDuplicates,
+		MaxFileSize:        cfg.MaxFileSize,
+		CheckDeps:          cfg.CheckDeps,
+		Allowlist:          allowlist,
+		FlagInstallScripts: cfg.FlagInstallScripts,
+		CheckProvenance:    cfg.CheckProvenance,
+		Score:              cfg.Score,
+		ScoreThreshold:     cfg.ScoreThreshold,
+		CheckPerms:         cfg.CheckPerms,
+		LenientJSON:        cfg.LenientJSON,
+		MtimeCheck:         cfg.MtimeCheck,
+		ModifiedAfter:      modifiedAfterTime,
+		NewerThan:          newerThanTime,
+		ScanTarballs:       cfg.ScanTarballs,
+		ContentRules:       contentRules,
+		FollowSymlinks:     cfg.FollowSymlinks,
+		MaxOpenFiles:       cfg.MaxOpenFiles,
+		ScanHidden:         cfg.ScanHidden,
+		Logf:               logf,
+	}
+	if cfg.Checkpoint != "" {
+		opts.OnRootDone = func(root string, matches []scanner.Match) {
+			progressFile.Completed = append(progressFile.Completed, checkpointRoot{root, matches})
+			if err := progressFile.save(cfg.Checkpoint); err != nil {
+				warnf("Could not write checkpoint %s: %v\n", cfg.Checkpoint, err)
+			}
+		}
+	}
+	var rewriter *pathRewriter
+	if cfg.RelativePaths {
+		rewriter = newPathRewriter(allRoots)
+		rewriter.byRoot = true
+	} else if cfg.RelativeTo != "" {
+		rewriter = newPathRewriter([]string{scanner.AbsPath(cfg.RelativeTo)})
+	}
+	// NDJSON always streams unless entries have to be collected first
+	streaming := !cfg.Dedupe && !cfg.SummaryOnly && (cfg.Stream && cfg.Format == "text" || cfg.Format == "ndjson" && !cfg.Inventory)
+	if streaming {
+		opts.OnMatch = func(m scanner.Match) {
+			m.Baselined = baseline != nil && baseline.Contains(m)
+			if rewriter != nil {
+				rewriter.match(&m)
+			}
+			if cfg.Format == "ndjson" {
+				writeNDJSONMatch(reportOut, m)
+			} else {
+				fmt.Fprintln(reportOut, formatReportLine(m))
+			}
+		}
+		for _, m := range restored {
+			opts.OnMatch(m)
+		}
+	}
+	// Cancel the scan on Ctrl-C or termination, keeping partial results
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.Timeout)
+		defer cancel()
+	}
+	if cfg.StopOnFirstMatch {
+		var cancelScan context.CancelCauseFunc
+		ctx, cancelScan = context.WithCancelCause(ctx)
+		defer cancelScan(nil)
+		report := opts.OnMatch
+		opts.OnMatch = func(m scanner.Match) {
+			if report != nil {
+				report(m)
+			}
+			m.Baselined = baseline != nil && baseline.Contains(m)
+			if hasFailingMatch([]scanner.Match{m}, cfg.FailOn) {
+				cancelScan(errFirstMatch)
+			}
 		}
+	}
 
-		fmt.Printf("Scanning: %s\n", dir)
-		matches, err := scanDirectory(dir, iocs)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Warning: error scanning %s: %v\n", dir, err)
+	// A first, cheap pass counts the files so progress can be shown as a percentage
+	var prog *progress
+	if cfg.Progress && isTerminal(os.Stderr) {
+		if total, err := scanner.CountFiles(ctx, opts); err == nil {
+			logf("Found %d files to check\n", total)
+			prog = startProgress(os.Stderr, total)
+			opts.OnChecked = prog.add
 		}
-		allMatches = append(allMatches, matches...)
+	}
+
+	result, err := scanner.ScanContext(ctx, opts)
+	if prog != nil {
+		prog.stop()
+	}
+	stoppedEarly := errors.Is(context.Cause(ctx), errFirstMatch)
+	interrupted := errors.Is(err, context.Canceled) && !stoppedEarly
+	timedOut := errors.Is(err, context.DeadlineExceeded)
+	partial := interrupted || timedOut || stoppedEarly
+	if err != nil && !partial {
+		fmt.Fprintf(os.Stderr, "Error scanning: %v\n", err)
+		exit(exitError)
+	}
+	stop()
+	if len(restored) > 0 {
+		result.Matches = append(result.Matches, restored...)
+		scanner.SortMatches(result.Matches)
+		if opts.Inventory {
+			result.Inventory = append(result.Inventory, restored...)
+			scanner.SortMatches(result.Inventory)
+		}
+	}
+	// A complete scan needs no checkpoint to resume from
+	if cfg.Checkpoint != "" && !partial {
+		if err := os.Remove(cfg.Checkpoint); err != nil && !os.IsNotExist(err) {
+			warnf("Could not remove checkpoint %s: %v\n", cfg.Checkpoint, err)
+		}
+	}
+	markBaselined(result.Matches, baseline)
+	markBaselined(result.Inventory, baseline)
+
+	// Accept every current match as known
+	if cfg.UpdateBaseline && !partial {
+		if err := writeBaseline(cfg.Baseline, result.Matches); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing baseline: %v\n", err)
+			exit(exitError)
+		}
+		logf("Wrote %d matches to baseline %s\n", len(result.Matches), cfg.Baseline)
+		for i := range result.Matches {
+			result.Matches[i].Baselined = true
+		}
+		for i := range result.Inventory {
+			result.Inventory[i].Baselined = result.Inventory[i].IOCMatched
+		}
+	}
+
+	// Duplicates are found before -dedupe merges the inventory entries
+	var duplicates []scanner.Duplicate
+	if cfg.ReportDuplicates {
+		duplicates = scanner.FindDuplicates(result.Inventory)
+	}
+
+	allMatches := result.Matches
+	if cfg.Dedupe {
+		allMatches = scanner.DedupeMatches(allMatches)
+		result.Inventory = scanner.DedupeMatches(result.Inventory)
+	}
+
+	// In inventory mode the report lists every package, matches included
+	report := allMatches
+	if cfg.Inventory {
+		report = result.Inventory
+	}
+
+	if interrupted {
+		warnf("scan interrupted, results are partial\n")
+	} else if timedOut {
+		warnf("scan timed out after %s, results are partial\n", cfg.Timeout)
 	}
 
 	// Report results
-	fmt.Printf("\nScan complete. Found %d matches.\n", len(allMatches))
-	if len(allMatches) > 0 {
-		fmt.Println("\nMatches:")
-		for _, match := range allMatches {
-			fmt.Println(match)
+	if interrupted {
+		logf("\nScan interrupted. Found %d matches so far.\n", len(allMatches))
+	} else if timedOut {
+		logf("\nScan timed out. Found %d matches so far.\n", len(allMatches))
+	} else if stoppedEarly {
+		logf("\nScan stopped at the first match. Found %d matches.\n", len(allMatches))
+	} else {
+		logf("\nScan complete. Found %d matches.\n", len(allMatches))
+	}
+	if cfg.Inventory {
+		logf("Inventory contains %d packages.\n", len(result.Inventory))
+	}
+	data := reportData{
+		Matches:    report,
+		Suspicious: result.Suspicious,
+		Unattested: result.Unattested,
+		Scored:     result.Scored,
+		Modified:   result.Modified,
+		Writable:   result.Writable,
+		Duplicates: duplicates,
+		Stats:      result.Stats,
+		Grouped:    !cfg.Flat && len(result.Scanned)+resumedRoots > 1,
+	}
+	if cfg.RelativeTo != "" {
+		data.RelativeTo = scanner.AbsPath(cfg.RelativeTo)
+	}
+	if rewriter != nil {
+		rewriter.report(&data)
+	}
+	switch {
+	case cfg.SummaryOnly:
+		err = writeSummaryOnly(reportOut, cfg.Format, result.Stats, len(allMatches), colorStdout && reportOut == io.Writer(os.Stdout))
+	case streaming && cfg.Format == "ndjson":
+		err = finishNDJSON(reportOut, data, len(allMatches))
+	case streaming:
+		err = writeTextSections(reportOut, data)
+	default:
+		err = writeResults(reportOut, cfg.Format, data)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing results: %v\n", err)
+		exit(exitError)
+	}
+	if cfg.LogFormat == "json" {
+		logSummary(result.Stats)
+	} else if !(cfg.SummaryOnly && cfg.Format == "text") && logger.Enabled(context.Background(), slog.LevelInfo) {
+		writeSummary(logOut, result.Stats, len(allMatches), colorStdout && logOut == io.Writer(os.Stdout))
+	}
+	if reportFile != nil {
+		if err := reportFile.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing results: %v\n", err)
+			exit(exitError)
 		}
-		os.Exit(1)
 	}
-	os.Exit(0)
+	if cfg.MetricsFile != "" {
+		if err := writeMetrics(cfg.MetricsFile, result.Scanned, result.Matches, result.Stats, partial); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing metrics: %v\n", err)
+			exit(exitError)
+		}
+	}
+	if interrupted {
+		exit(exitInterrupted)
+	}
+	if timedOut {
+		exit(exitTimeout)
+	}
+	if hasFailingMatch(allMatches, cfg.FailOn) {
+		exit(exitMatch)
+	}
+	if cfg.FailOnError && result.Stats.ParseErrors+result.Stats.WalkErrors > 0 {
+		exit(exitUnreadable)
+	}
+	exit(exitOK)
 }
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cschneider4711/quick-npm-module-scanner/scanner"
+)
+
+// labelEscaper escapes a Prometheus label value
+var labelEscaper = strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n")
+
+// writeMetrics writes the scan results in the Prometheus text exposition
+// format, for node_exporter's textfile collector. The file is replaced
+// atomically, so a scrape never reads it half-written.
+func writeMetrics(path string, roots []string, matches []scanner.Match, stats scanner.Stats, partial bool) error {
+	complete := 1
+	if partial {
+		complete = 0
+	}
+
+	roots = append([]string(nil), roots...)
+	perRoot := make(map[string]int)
+	for _, root := range roots {
+		perRoot[root] = 0
+	}
+	// Roots resumed from a checkpoint only appear in the matches
+	for _, m := range matches {
+		if _, ok := perRoot[m.Root]; !ok {
+			roots = append(roots, m.Root)
+			perRoot[m.Root] = 0
+		}
+	}
+	for _, m := range matches {
+		if m.IOCMatched {
+			perRoot[m.Root]++
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("# HELP npm_scan_matches_total IOC matches found by the last scan.\n")
+	b.WriteString("# TYPE npm_scan_matches_total gauge\n")
+	for _, root := range roots {
+		fmt.Fprintf(&b, "npm_scan_matches_total{root=\"%s\"} %d\n", labelEscaper.Replace(root), perRoot[root])
+	}
+	b.WriteString("# HELP npm_scan_packages_total package.json files parsed by the last scan.\n")
+	b.WriteString("# TYPE npm_scan_packages_total gauge\n")
+	fmt.Fprintf(&b, "npm_scan_packages_total %d\n", stats.Packages)
+	b.WriteString("# HELP npm_scan_lockfiles_total Lockfiles parsed by the last scan.\n")
+	b.WriteString("# TYPE npm_scan_lockfiles_total gauge\n")
+	fmt.Fprintf(&b, "npm_scan_lockfiles_total %d\n", stats.Lockfiles)
+	b.WriteString("# HELP npm_scan_duration_seconds Duration of the last scan.\n")
+	b.WriteString("# TYPE npm_scan_duration_seconds gauge\n")
+	fmt.Fprintf(&b, "npm_scan_duration_seconds %g\n", stats.Elapsed.Seconds())
+	b.WriteString("# HELP npm_scan_errors_total Files and directories the last scan could not read or parse.\n")
+	b.WriteString("# TYPE npm_scan_errors_total gauge\n")
+	fmt.Fprintf(&b, "npm_scan_errors_total{kind=\"parse\"} %d\n", stats.ParseErrors)
+	fmt.Fprintf(&b, "npm_scan_errors_total{kind=\"walk\"} %d\n", stats.WalkErrors)
+	b.WriteString("# HELP npm_scan_complete Whether the last scan completed (0 if it was interrupted or timed out).\n")
+	b.WriteString("# TYPE npm_scan_complete gauge\n")
+	fmt.Fprintf(&b, "npm_scan_complete %d\n", complete)
+	return scanner.WriteFileAtomic(path, []byte(b.String()))
+}
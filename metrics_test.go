@@ -0,0 +1,58 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cschneider4711/quick-npm-module-scanner/scanner"
+)
+
+func TestWriteMetrics(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "npm_scan.prom")
+	matches := []scanner.Match{
+		{Name: "x", Version: "1.0.0", Root: "/a", IOCMatched: true},
+		{Name: "y", Version: "1.0.0", Root: "/a", IOCMatched: true},
+		{Name: "z", Version: "1.0.0", Root: "/a"},
+		{Name: "x", Version: "1.0.0", Root: "/resumed", IOCMatched: true},
+	}
+	stats := scanner.Stats{Packages: 12, Lockfiles: 3, ParseErrors: 1, Elapsed: 1500 * time.Millisecond}
+	if err := writeMetrics(path, []string{"/a", `/b"c`}, matches, stats, true); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(string(data), "\n")
+	for _, want := range []string{
+		`npm_scan_matches_total{root="/a"} 2`,
+		`npm_scan_matches_total{root="/b\"c"} 0`,
+		`npm_scan_matches_total{root="/resumed"} 1`,
+		"npm_scan_packages_total 12",
+		"npm_scan_lockfiles_total 3",
+		"npm_scan_duration_seconds 1.5",
+		`npm_scan_errors_total{kind="parse"} 1`,
+		`npm_scan_errors_total{kind="walk"} 0`,
+		"npm_scan_complete 0",
+	} {
+		if !slices.Contains(lines, want) {
+			t.Errorf("metrics lack %q:\n%s", want, data)
+		}
+	}
+
+	// node_exporter runs as another user and must be able to read the file
+	if runtime.GOOS != "windows" {
+		fi, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if perm := fi.Mode().Perm(); perm&0o044 != 0o044 {
+			t.Errorf("metrics file mode %v, want readable by all", perm)
+		}
+	}
+}
@@ -0,0 +1,1046 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cschneider4711/quick-npm-module-scanner/scanner"
+)
+
+// toolName identifies this scanner in machine-readable reports
+const toolName = "quick-npm-module-scanner"
+
+// isValidFormat reports whether the given output format is supported
+func isValidFormat(format string) bool {
+	switch format {
+	case "text", "json", "ndjson", "sarif", "cyclonedx", "html", "markdown":
+		return true
+	}
+	return false
+}
+
+// reportData is what the report writers render
+type reportData struct {
+	Matches    []scanner.Match    // IOC matches, or all packages in inventory mode
+	Suspicious []scanner.Match    // packages with install scripts, if flagged
+	Unattested []scanner.Match    // packages without provenance, if checked
+	Scored     []scanner.Match    // packages reaching the suspicion score threshold, if scored
+	Modified   []scanner.Match    // packages modified after install, if checked
+	Writable   []scanner.Writable // node_modules writable by group or others, if checked
+	Duplicates []scanner.Duplicate
+	Stats      scanner.Stats
+	Grouped    bool   // group matches by scan root (text only)
+	RelativeTo string // directory paths are relative to (-relative-to), if set
+}
+
+// writeResults writes the report to w in the requested format
+func writeResults(w io.Writer, format string, data reportData) error {
+	switch format {
+	case "json":
+		return writeJSON(w, data)
+	case "ndjson":
+		return writeNDJSON(w, data)
+	case "sarif":
+		return writeSARIF(w, data)
+	case "cyclonedx":
+		return writeCycloneDX(w, data.Matches)
+	case "html":
+		return writeHTML(w, data)
+	case "markdown":
+		return writeMarkdown(w, data)
+	default:
+		if err := writeText(w, data.Matches, data.Grouped); err != nil {
+			return err
+		}
+		return writeTextSections(w, data)
+	}
+}
+
+// writeTextSections writes the informational lists following the matches
+// in the text report, which stay apart from the IOC matches
+func writeTextSections(w io.Writer, data reportData) error {
+	if err := writeSuspicious(w, data.Suspicious); err != nil {
+		return err
+	}
+	if err := writeUnattested(w, data.Unattested); err != nil {
+		return err
+	}
+	if err := writeScored(w, data.Scored); err != nil {
+		return err
+	}
+	if err := writeModified(w, data.Modified); err != nil {
+		return err
+	}
+	if err := writeWritable(w, data.Writable); err != nil {
+		return err
+	}
+	return writeDuplicates(w, data.Duplicates)
+}
+
+// writeIOCReport writes the validation results of one IOC source
+func writeIOCReport(w io.Writer, source string, report *scanner.IOCReport) error {
+	if _, err := fmt.Fprintf(w, "%s: %d valid entries, %d problems\n", source, report.Entries, report.Problems()); err != nil {
+		return err
+	}
+	sections := []struct {
+		label string
+		lines []string
+	}{
+		{"Malformed", report.Malformed},
+		{"Duplicates", report.Duplicates},
+		{"Unparseable ranges", report.BadRanges},
+	}
+	for _, section := range sections {
+		if len(section.lines) == 0 {
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "  %s (%d):\n", section.label, len(section.lines)); err != nil {
+			return err
+		}
+		for _, line := range section.lines {
+			if _, err := fmt.Fprintln(w, "    "+line); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeDryRun lists the resolved scan roots, marking those that do not
+// exist, followed by a count of the existing ones
+func writeDryRun(w io.Writer, dirs []string) error {
+	if _, err := fmt.Fprintln(w, "Directories to scan:"); err != nil {
+		return err
+	}
+	existing := 0
+	for _, dir := range dirs {
+		line := "  " + dir
+		if _, err := os.Stat(dir); err == nil {
+			existing++
+		} else {
+			line += " (missing)"
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "%d of %d directories exist\n", existing, len(dirs))
+	return err
+}
+
+// rootGroup holds the matches found below one scan root. In JSON reports
+// it only carries the count, as the matches are listed flat.
+type rootGroup struct {
+	Root    string          `json:"root"`
+	Count   int             `json:"count"`
+	Matches []scanner.Match `json:"-"`
+}
+
+// groupByRoot splits matches by scan root, keeping the order in which the
+// roots first appear
+func groupByRoot(matches []scanner.Match) []rootGroup {
+	var groups []rootGroup
+	index := make(map[string]int)
+	for _, m := range matches {
+		i, ok := index[m.Root]
+		if !ok {
+			i = len(groups)
+			index[m.Root] = i
+			groups = append(groups, rootGroup{Root: m.Root})
+		}
+		groups[i].Matches = append(groups[i].Matches, m)
+		groups[i].Count++
+	}
+	return groups
+}
+
+// writeText writes matches as human-readable lines, optionally grouped by
+// scan root with per-root counts and a grand total
+func writeText(w io.Writer, matches []scanner.Match, grouped bool) error {
+	if len(matches) == 0 {
+		return nil
+	}
+	header, noun := "\nMatches:", "match"
+	if !allIOCMatches(matches) {
+		header, noun = "\nPackages:", "package"
+	}
+	if _, err := fmt.Fprintln(w, header); err != nil {
+		return err
+	}
+
+	if !grouped {
+		for _, m := range matches {
+			if _, err := fmt.Fprintln(w, formatReportLine(m)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, group := range groupByRoot(matches) {
+		if _, err := fmt.Fprintf(w, "%s (%s):\n", group.Root, plural(group.Count, noun)); err != nil {
+			return err
+		}
+		for _, m := range group.Matches {
+			line := strings.ReplaceAll(formatReportLine(m), "\n", "\n  ")
+			if _, err := fmt.Fprintln(w, "  "+line); err != nil {
+				return err
+			}
+		}
+	}
+	_, err := fmt.Fprintf(w, "Total: %s\n", plural(len(matches), noun))
+	return err
+}
+
+// plural formats a count with a noun, adding "es" or "s" unless it is one
+func plural(n int, noun string) string {
+	switch {
+	case n == 1:
+		return "1 " + noun
+	case strings.HasSuffix(noun, "ch"):
+		return fmt.Sprintf("%d %ses", n, noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// formatReportLine renders a match for the text report, in red if colored
+// output is enabled and the match is a new IOC match
+func formatReportLine(m scanner.Match) string {
+	line := formatMatchLine(m)
+	if colorReport && m.IOCMatched && !m.Baselined {
+		line = paint(colorRed, line)
+	}
+	return line
+}
+
+// writeSuspicious writes the packages with install scripts as a separate
+// human-readable list
+func writeSuspicious(w io.Writer, suspicious []scanner.Match) error {
+	if len(suspicious) == 0 {
+		return nil
+	}
+	if _, err := fmt.Fprintln(w, "\nPackages with install scripts:"); err != nil {
+		return err
+	}
+	for _, m := range suspicious {
+		line := fmt.Sprintf("[SCRIPT] %s@%s: %s", m.Name, m.Version, m.Path)
+		for _, script := range m.InstallScripts {
+			line += "\n    " + script
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeUnattested writes the packages without provenance as a separate
+// list, kept apart from the IOC matches as it is only a weak signal
+func writeUnattested(w io.Writer, unattested []scanner.Match) error {
+	if len(unattested) == 0 {
+		return nil
+	}
+	if _, err := fmt.Fprintln(w, "\nPackages without provenance (weak signal):"); err != nil {
+		return err
+	}
+	for _, m := range unattested {
+		if _, err := fmt.Fprintf(w, "[NO-PROVENANCE] %s@%s: %s\n", m.Name, m.Version, m.Path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeScored writes the packages reaching the suspicion score threshold,
+// highest score first, as a triage list apart from the IOC matches
+func writeScored(w io.Writer, scored []scanner.Match) error {
+	if len(scored) == 0 {
+		return nil
+	}
+	if _, err := fmt.Fprintln(w, "\nSuspicious packages by score:"); err != nil {
+		return err
+	}
+	for _, m := range scored {
+		if _, err := fmt.Fprintf(w, "[SCORE %d] %s@%s: %s (%s)\n", m.Score, m.Name, m.Version, m.Path, strings.Join(m.ScoreReasons, ", ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeModified writes the packages with files modified after install,
+// with the newest such file
+func writeModified(w io.Writer, modified []scanner.Match) error {
+	if len(modified) == 0 {
+		return nil
+	}
+	if _, err := fmt.Fprintln(w, "\nPackages modified after install:"); err != nil {
+		return err
+	}
+	for _, m := range modified {
+		if _, err := fmt.Fprintf(w, "[MODIFIED] %s@%s: %s (modified %s)\n", m.Name, m.Version, m.ModifiedFile, m.ModifiedAt.Format(time.RFC3339)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeWritable writes the node_modules directories and package.json files
+// that group or others may write to, with their mode
+func writeWritable(w io.Writer, writable []scanner.Writable) error {
+	if len(writable) == 0 {
+		return nil
+	}
+	if _, err := fmt.Fprintln(w, "\nWritable by group or others (hardening):"); err != nil {
+		return err
+	}
+	for _, f := range writable {
+		if _, err := fmt.Fprintf(w, "[WRITABLE] %s %s\n", f.Mode, f.Path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// markdownEscaper escapes characters that would break a Markdown table
+// cell or be taken as formatting
+var markdownEscaper = strings.NewReplacer("|", "\\|", "\\", "\\\\", "`", "\\`", "*", "\\*", "_", "\\_", "<", "&lt;", ">", "&gt;", "\n", " ")
+
+// writeMarkdown writes the matches as a Markdown table followed by a
+// summary line, e.g. for a pull request comment
+func writeMarkdown(w io.Writer, data reportData) error {
+	var b strings.Builder
+	noun := "IOC match"
+	if !allIOCMatches(data.Matches) {
+		noun = "package"
+	}
+	if len(data.Matches) == 0 {
+		b.WriteString("No IOC matches found ✅\n")
+	} else {
+		b.WriteString("| Package | Version | Severity | Path |\n")
+		b.WriteString("| --- | --- | --- | --- |\n")
+		for _, m := range data.Matches {
+			severity := ""
+			if m.IOCMatched {
+				severity = m.Severity
+				if severity == "" {
+					severity = "critical"
+				}
+				if m.Baselined {
+					severity += " (known)"
+				}
+			}
+			fmt.Fprintf(&b, "| %s | %s | %s | %s |\n", markdownEscaper.Replace(m.Name),
+				markdownEscaper.Replace(m.Version), markdownEscaper.Replace(severity), markdownEscaper.Replace(m.Path))
+		}
+	}
+
+	if len(data.Suspicious) > 0 {
+		b.WriteString("\n**Packages with install scripts:**\n\n")
+		for _, m := range data.Suspicious {
+			fmt.Fprintf(&b, "- %s@%s: %s\n", markdownEscaper.Replace(m.Name), markdownEscaper.Replace(m.Version), markdownEscaper.Replace(m.Path))
+		}
+	}
+	if len(data.Unattested) > 0 {
+		b.WriteString("\n**Packages without provenance (weak signal):**\n\n")
+		for _, m := range data.Unattested {
+			fmt.Fprintf(&b, "- %s@%s: %s\n", markdownEscaper.Replace(m.Name), markdownEscaper.Replace(m.Version), markdownEscaper.Replace(m.Path))
+		}
+	}
+	if len(data.Scored) > 0 {
+		b.WriteString("\n**Suspicious packages by score:**\n\n")
+		for _, m := range data.Scored {
+			fmt.Fprintf(&b, "- %d: %s@%s (%s)\n", m.Score, markdownEscaper.Replace(m.Name), markdownEscaper.Replace(m.Version),
+				markdownEscaper.Replace(strings.Join(m.ScoreReasons, ", ")))
+		}
+	}
+	if len(data.Modified) > 0 {
+		b.WriteString("\n**Packages modified after install:**\n\n")
+		for _, m := range data.Modified {
+			fmt.Fprintf(&b, "- %s@%s: %s (modified %s)\n", markdownEscaper.Replace(m.Name), markdownEscaper.Replace(m.Version),
+				markdownEscaper.Replace(m.ModifiedFile), m.ModifiedAt.Format(time.RFC3339))
+		}
+	}
+	if len(data.Writable) > 0 {
+		b.WriteString("\n**Writable by group or others (hardening):**\n\n")
+		for _, f := range data.Writable {
+			fmt.Fprintf(&b, "- %s %s\n", markdownEscaper.Replace(f.Mode), markdownEscaper.Replace(f.Path))
+		}
+	}
+	if len(data.Duplicates) > 0 {
+		b.WriteString("\n**Packages installed at several versions:**\n\n")
+		for _, dup := range data.Duplicates {
+			var versions []string
+			for _, v := range dup.Versions {
+				versions = append(versions, markdownEscaper.Replace(v.Version))
+			}
+			fmt.Fprintf(&b, "- %s: %s\n", markdownEscaper.Replace(dup.Name), strings.Join(versions, ", "))
+		}
+	}
+
+	b.WriteString("\n" + markdownSummary(len(data.Matches), noun, data.Stats))
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// markdownSummary returns the summary line closing a Markdown report
+func markdownSummary(count int, noun string, stats scanner.Stats) string {
+	return fmt.Sprintf("%s in %s (%s, %s checked, %s)\n",
+		plural(count, noun), plural(stats.Roots, "scan root"), plural(stats.Packages, "package"),
+		plural(stats.Lockfiles, "lockfile"), plural(stats.ParseErrors, "parse failure"))
+}
+
+// writeSummaryOnly writes just the summary of a report in the given format
+// (text, json, ndjson or markdown), with the number of IOC matches but
+// without listing them
+func writeSummaryOnly(w io.Writer, format string, stats scanner.Stats, matches int, color bool) error {
+	summary := jsonSummary{
+		Stats:          stats,
+		Matches:        matches,
+		ElapsedSeconds: stats.Elapsed.Seconds(),
+	}
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(summary)
+	case "ndjson":
+		return writeNDJSONRecord(w, recordSummary, summary)
+	case "markdown":
+		_, err := io.WriteString(w, markdownSummary(matches, "IOC match", stats))
+		return err
+	default:
+		writeSummary(w, stats, matches, color)
+		return nil
+	}
+}
+
+// isValidSummaryFormat reports whether -summary-only supports the format
+func isValidSummaryFormat(format string) bool {
+	switch format {
+	case "text", "json", "ndjson", "markdown":
+		return true
+	}
+	return false
+}
+
+// writeDuplicates lists the packages installed at several versions
+func writeDuplicates(w io.Writer, dups []scanner.Duplicate) error {
+	if len(dups) == 0 {
+		return nil
+	}
+	if _, err := fmt.Fprintln(w, "\nPackages installed at several versions:"); err != nil {
+		return err
+	}
+	for _, dup := range dups {
+		line := fmt.Sprintf("[DUPLICATE] %s (%d versions)", dup.Name, len(dup.Versions))
+		for _, v := range dup.Versions {
+			for _, path := range v.Paths {
+				line += fmt.Sprintf("\n    %s: %s", v.Version, path)
+			}
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// allIOCMatches reports whether the list holds only IOC matches (no inventory entries)
+func allIOCMatches(matches []scanner.Match) bool {
+	for _, m := range matches {
+		if !m.IOCMatched {
+			return false
+		}
+	}
+	return true
+}
+
+// showRule reports whether the IOC rule of a match is worth showing: exact
+// entries say nothing beyond the name and version, hashes are shown as the
+// integrity and content rules are named in the reason
+func showRule(m scanner.Match) bool {
+	return m.MatchedRule != "" && m.Integrity == "" && m.Source != scanner.SourceContent &&
+		m.MatchedRule != m.Name+","+m.Version
+}
+
+// formatMatchLine renders a single match (or inventory entry) as a human-readable line
+func formatMatchLine(m scanner.Match) string {
+	tag := "[MATCH]"
+	if !m.IOCMatched {
+		tag = "[PACKAGE]"
+	} else if m.Baselined {
+		tag = "[KNOWN]"
+	}
+	line := fmt.Sprintf("%s %s@%s: %s", tag, m.Name, m.Version, m.Path)
+	switch m.Source {
+	case scanner.SourceLockfile:
+		line += " (lockfile)"
+	case scanner.SourceDeclared:
+		line += " (declared)"
+	case scanner.SourceOverride:
+		line += " (forced via overrides)"
+	case scanner.SourceTarball:
+		line += " (tarball)"
+	case scanner.SourceCache:
+		line += " (npm cache)"
+	case scanner.SourceContent:
+		line += fmt.Sprintf(" (line %d)", m.Line)
+	}
+	if m.Integrity != "" {
+		line += fmt.Sprintf(" [integrity %s]", m.Integrity)
+	}
+	if showRule(m) {
+		line += fmt.Sprintf(" [rule %s]", m.MatchedRule)
+	}
+	if m.Severity != "" {
+		line += fmt.Sprintf(" [%s]", m.Severity)
+	}
+	if m.Reason != "" {
+		line += fmt.Sprintf(" (%s)", m.Reason)
+	}
+	// A chain of one is a direct dependency and says nothing new
+	if len(m.Chain) > 1 {
+		line += " (via " + strings.Join(m.Chain, " > ") + ")"
+	}
+	if len(m.Paths) > 1 {
+		line += fmt.Sprintf(" (found in %d locations)", len(m.Paths))
+		for _, p := range m.Paths[1:] {
+			line += "\n    also: " + p
+		}
+	}
+	return line
+}
+
+// jsonSummary is the "summary" object of the JSON report
+type jsonSummary struct {
+	scanner.Stats
+	Matches        int     `json:"matches"`
+	ElapsedSeconds float64 `json:"elapsedSeconds"`
+}
+
+// jsonReport is the top-level object of the JSON report. Its shape does
+// not depend on the number of scan roots: matches are always listed flat,
+// each with its root, and roots holds the number of matches per root.
+type jsonReport struct {
+	Summary    jsonSummary         `json:"summary"`
+	Matches    []scanner.Match     `json:"matches"`
+	Roots      []rootGroup         `json:"roots"`
+	Suspicious []scanner.Match     `json:"suspicious,omitempty"` // packages with install scripts
+	Unattested []scanner.Match     `json:"unattested,omitempty"` // packages without provenance
+	Scored     []scanner.Match     `json:"scored,omitempty"`     // packages by suspicion score
+	Modified   []scanner.Match     `json:"modified,omitempty"`   // packages modified after install
+	Writable   []scanner.Writable  `json:"writable,omitempty"`   // node_modules writable by group or others
+	Duplicates []scanner.Duplicate `json:"duplicates,omitempty"` // packages installed at several versions
+}
+
+// writeJSON writes the scan summary and the matches as a JSON object. The
+// matches and roots arrays are always present, even when empty.
+func writeJSON(w io.Writer, data reportData) error {
+	report := jsonReport{
+		Summary: jsonSummary{
+			Stats:          data.Stats,
+			Matches:        countIOCMatches(data.Matches),
+			ElapsedSeconds: data.Stats.Elapsed.Seconds(),
+		},
+		Matches:    data.Matches,
+		Roots:      groupByRoot(data.Matches),
+		Suspicious: data.Suspicious,
+		Unattested: data.Unattested,
+		Scored:     data.Scored,
+		Modified:   data.Modified,
+		Writable:   data.Writable,
+		Duplicates: data.Duplicates,
+	}
+	if report.Matches == nil {
+		report.Matches = []scanner.Match{}
+	}
+	if report.Roots == nil {
+		report.Roots = []rootGroup{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
+
+// countIOCMatches returns the number of IOC matches, not counting inventory entries
+func countIOCMatches(matches []scanner.Match) int {
+	n := 0
+	for _, m := range matches {
+		if m.IOCMatched {
+			n++
+		}
+	}
+	return n
+}
+
+// logSummary logs the scan statistics as one structured message
+func logSummary(stats scanner.Stats) {
+	logger.Info("Scan summary",
+		"roots", stats.Roots,
+		"packageFiles", stats.PackageFiles,
+		"packages", stats.Packages,
+		"lockfiles", stats.Lockfiles,
+		"parseErrors", stats.ParseErrors,
+		"walkErrors", stats.WalkErrors,
+		"cacheEntries", stats.CacheEntries,
+		"contentFiles", stats.ContentFiles,
+		"elapsed", stats.Elapsed,
+	)
+}
+
+// writeSummary writes the scan statistics and the number of IOC matches
+// as a human-readable block, in green if color is set
+func writeSummary(w io.Writer, stats scanner.Stats, matches int, color bool) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Summary:\n")
+	fmt.Fprintf(&b, "  IOC matches:         %d\n", matches)
+	fmt.Fprintf(&b, "  Scan roots:          %d\n", stats.Roots)
+	fmt.Fprintf(&b, "  package.json files:  %d\n", stats.PackageFiles)
+	fmt.Fprintf(&b, "  Packages parsed:     %d\n", stats.Packages)
+	fmt.Fprintf(&b, "  Lockfiles parsed:    %d\n", stats.Lockfiles)
+	fmt.Fprintf(&b, "  Parse failures:      %d\n", stats.ParseErrors)
+	fmt.Fprintf(&b, "  Inaccessible paths:  %d\n", stats.WalkErrors)
+	if stats.CacheEntries > 0 {
+		fmt.Fprintf(&b, "  Cache entries:       %d\n", stats.CacheEntries)
+	}
+	if stats.ContentFiles > 0 {
+		fmt.Fprintf(&b, "  Source files:        %d\n", stats.ContentFiles)
+	}
+	fmt.Fprintf(&b, "  Elapsed:             %s", stats.Elapsed.Round(time.Millisecond))
+	summary := b.String()
+	if color {
+		summary = paint(colorGreen, summary)
+	}
+	fmt.Fprintf(w, "\n%s\n", summary)
+}
+
+// writeBaseline writes matches to path as a JSON array, which -baseline
+// reads back like a full JSON report
+func writeBaseline(path string, matches []scanner.Match) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if matches == nil {
+		matches = []scanner.Match{}
+	}
+	enc := json.NewEncoder(file)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(matches); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// NDJSON record types
+const (
+	recordMatch      = "match"      // IOC match
+	recordPackage    = "package"    // inventory entry
+	recordSuspicious = "suspicious" // package with install scripts
+	recordUnattested = "unattested" // package without provenance
+	recordScored     = "scored"     // package reaching the suspicion score threshold
+	recordModified   = "modified"   // package modified after install
+	recordWritable   = "writable"   // node_modules directory or package.json writable by group or others
+	recordDuplicate  = "duplicate"  // package installed at several versions
+	recordSummary    = "summary"    // scan summary, always the last record
+)
+
+// writeNDJSON writes one JSON object per line: each match, then each
+// package with install scripts, without provenance, with a suspicion score
+// or modified after install, each writable path and each duplicate, then
+// the summary
+func writeNDJSON(w io.Writer, data reportData) error {
+	for _, m := range data.Matches {
+		if err := writeNDJSONMatch(w, m); err != nil {
+			return err
+		}
+	}
+	return finishNDJSON(w, data, countIOCMatches(data.Matches))
+}
+
+// writeNDJSONMatch writes a single match record, so matches can be
+// streamed as they are found
+func writeNDJSONMatch(w io.Writer, m scanner.Match) error {
+	record := recordMatch
+	if !m.IOCMatched {
+		record = recordPackage
+	}
+	return writeNDJSONRecord(w, record, m)
+}
+
+// finishNDJSON writes the records following the matches; data.Matches is
+// not used, as the matches may have been streamed already
+func finishNDJSON(w io.Writer, data reportData, matchCount int) error {
+	for _, m := range data.Suspicious {
+		if err := writeNDJSONRecord(w, recordSuspicious, m); err != nil {
+			return err
+		}
+	}
+	for _, m := range data.Unattested {
+		if err := writeNDJSONRecord(w, recordUnattested, m); err != nil {
+			return err
+		}
+	}
+	for _, m := range data.Scored {
+		if err := writeNDJSONRecord(w, recordScored, m); err != nil {
+			return err
+		}
+	}
+	for _, m := range data.Modified {
+		if err := writeNDJSONRecord(w, recordModified, m); err != nil {
+			return err
+		}
+	}
+	for _, f := range data.Writable {
+		if err := writeNDJSONRecord(w, recordWritable, f); err != nil {
+			return err
+		}
+	}
+	for _, dup := range data.Duplicates {
+		if err := writeNDJSONRecord(w, recordDuplicate, dup); err != nil {
+			return err
+		}
+	}
+	summary := jsonSummary{
+		Stats:          data.Stats,
+		Matches:        matchCount,
+		ElapsedSeconds: data.Stats.Elapsed.Seconds(),
+	}
+	return writeNDJSONRecord(w, recordSummary, summary)
+}
+
+// writeNDJSONRecord writes v as one JSON line with an added "type" field
+func writeNDJSONRecord(w io.Writer, record string, v any) error {
+	var line []byte
+	var err error
+	switch v := v.(type) {
+	case scanner.Match:
+		line, err = json.Marshal(struct {
+			Type string `json:"type"`
+			scanner.Match
+		}{record, v})
+	case scanner.Duplicate:
+		line, err = json.Marshal(struct {
+			Type string `json:"type"`
+			scanner.Duplicate
+		}{record, v})
+	case scanner.Writable:
+		line, err = json.Marshal(struct {
+			Type string `json:"type"`
+			scanner.Writable
+		}{record, v})
+	case jsonSummary:
+		line, err = json.Marshal(struct {
+			Type string `json:"type"`
+			jsonSummary
+		}{record, v})
+	}
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(line, '\n'))
+	return err
+}
+
+// SARIF 2.1.0 document structure (only the parts we emit)
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool               sarifTool                        `json:"tool"`
+	OriginalURIBaseIDs map[string]sarifArtifactLocation `json:"originalUriBaseIds,omitempty"`
+	Results            []sarifResult                    `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	Version        string      `json:"version,omitempty"`
+	InformationURI string      `json:"informationUri,omitempty"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+type sarifArtifactLocation struct {
+	URI       string `json:"uri"`
+	URIBaseID string `json:"uriBaseId,omitempty"`
+}
+
+// srcRootID is the SARIF base ID of the -relative-to directory, the one
+// GitHub code scanning resolves against the repository checkout
+const srcRootID = "%SRCROOT%"
+
+// sarifBases assigns SARIF base IDs to the directories relative paths in a
+// report are relative to: %SRCROOT% for -relative-to, ROOT1, ROOT2, ...
+// for the scan roots with -relative-paths
+type sarifBases struct {
+	relativeTo string
+	ids        map[string]string // directory -> base ID
+	locations  map[string]sarifArtifactLocation
+}
+
+// artifact returns the location of the file of m: relative to a base ID if
+// the report paths are relative, else as an absolute file:// URI
+func (b *sarifBases) artifact(m scanner.Match) sarifArtifactLocation {
+	file := m.File()
+	if filepath.IsAbs(file) {
+		return sarifArtifactLocation{URI: fileURI(file)}
+	}
+	dir := b.relativeTo
+	if dir == "" {
+		dir = m.Root
+	}
+	id, ok := b.ids[dir]
+	if !ok {
+		id = srcRootID
+		if b.relativeTo == "" {
+			id = fmt.Sprintf("ROOT%d", len(b.ids)+1)
+		}
+		if b.ids == nil {
+			b.ids = make(map[string]string)
+			b.locations = make(map[string]sarifArtifactLocation)
+		}
+		b.ids[dir] = id
+		b.locations[id] = sarifArtifactLocation{URI: strings.TrimSuffix(fileURI(dir), "/") + "/"}
+	}
+	return sarifArtifactLocation{URI: (&url.URL{Path: filepath.ToSlash(file)}).String(), URIBaseID: id}
+}
+
+// fileURI returns the file:// URI of an absolute path; Windows paths get
+// the leading slash of file:///C:/...
+func fileURI(path string) string {
+	p := filepath.ToSlash(path)
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+	return (&url.URL{Scheme: "file", Path: p}).String()
+}
+
+// sarifRuleID derives a rule ID from the IOC package name
+func sarifRuleID(name string) string {
+	return "npm-ioc/" + name
+}
+
+// writeSARIF writes matches as a SARIF 2.1.0 document with a single run.
+// Absolute paths become file:// URIs; relative ones (-relative-paths,
+// -relative-to) refer to a base ID resolved in originalUriBaseIds.
+func writeSARIF(w io.Writer, data reportData) error {
+	rules := []sarifRule{}
+	results := []sarifResult{}
+	seenRules := make(map[string]bool)
+	bases := &sarifBases{relativeTo: data.RelativeTo}
+
+	for _, m := range data.Matches {
+		// Inventory entries are not findings
+		if !m.IOCMatched {
+			continue
+		}
+
+		ruleID := sarifRuleID(m.Name)
+		if !seenRules[ruleID] {
+			seenRules[ruleID] = true
+			rules = append(rules, sarifRule{
+				ID:               ruleID,
+				ShortDescription: sarifMessage{Text: fmt.Sprintf("Compromised npm package %s", m.Name)},
+			})
+		}
+
+		message := fmt.Sprintf("%s@%s matches a known IOC", m.Name, m.Version)
+		if m.Reason != "" {
+			message += ": " + m.Reason
+		}
+
+		// Triaged matches stay visible without failing code scanning gates
+		level := "error"
+		if m.Baselined {
+			level = "note"
+		}
+
+		location := sarifPhysicalLocation{ArtifactLocation: bases.artifact(m)}
+		if m.Line > 0 {
+			location.Region = &sarifRegion{StartLine: m.Line}
+		}
+		results = append(results, sarifResult{
+			RuleID:    ruleID,
+			Level:     level,
+			Message:   sarifMessage{Text: message},
+			Locations: []sarifLocation{{PhysicalLocation: location}},
+		})
+	}
+
+	doc := sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs: []sarifRun{{
+			Tool: sarifTool{Driver: sarifDriver{
+				Name:           toolName,
+				Version:        Version,
+				InformationURI: "https://github.com/cschneider4711/quick-npm-module-scanner",
+				Rules:          rules,
+			}},
+			OriginalURIBaseIDs: bases.locations,
+			Results:            results,
+		}},
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+// CycloneDX 1.5 BOM structure (only the parts we emit)
+type cdxBOM struct {
+	BOMFormat    string         `json:"bomFormat"`
+	SpecVersion  string         `json:"specVersion"`
+	SerialNumber string         `json:"serialNumber"`
+	Version      int            `json:"version"`
+	Metadata     cdxMetadata    `json:"metadata"`
+	Components   []cdxComponent `json:"components"`
+}
+
+type cdxMetadata struct {
+	Timestamp string   `json:"timestamp"`
+	Tools     cdxTools `json:"tools"`
+}
+
+type cdxTools struct {
+	Components []cdxComponent `json:"components"`
+}
+
+type cdxComponent struct {
+	Type     string       `json:"type"`
+	BOMRef   string       `json:"bom-ref,omitempty"`
+	Group    string       `json:"group,omitempty"`
+	Name     string       `json:"name"`
+	Version  string       `json:"version,omitempty"`
+	PURL     string       `json:"purl,omitempty"`
+	Evidence *cdxEvidence `json:"evidence,omitempty"`
+}
+
+type cdxEvidence struct {
+	Occurrences []cdxOccurrence `json:"occurrences"`
+}
+
+type cdxOccurrence struct {
+	Location string `json:"location"`
+}
+
+// npmPURL builds a package URL, encoding the "@" of scoped names
+// (e.g. "pkg:npm/%40scope/name@1.0.0")
+func npmPURL(name, version string) string {
+	if strings.HasPrefix(name, "@") {
+		name = "%40" + name[1:]
+	}
+	return fmt.Sprintf("pkg:npm/%s@%s", name, url.PathEscape(version))
+}
+
+// writeCycloneDX writes all installed packages as a CycloneDX 1.5 JSON BOM.
+// Packages installed in several places become one component listing every
+// location as an occurrence. Other entries are no installed name@version:
+// declared ranges and overrides, lockfile, tarball and cache entries and
+// content rule hits are left out.
+func writeCycloneDX(w io.Writer, packages []scanner.Match) error {
+	components := []cdxComponent{}
+	byPURL := make(map[string]int)
+
+	for _, m := range packages {
+		if m.Source != scanner.SourceInstalled {
+			continue
+		}
+		purl := npmPURL(m.Name, m.Version)
+		occurrence := cdxOccurrence{Location: filepath.ToSlash(m.File())}
+		if i, ok := byPURL[purl]; ok {
+			components[i].Evidence.Occurrences = append(components[i].Evidence.Occurrences, occurrence)
+			continue
+		}
+
+		group, name := "", m.Name
+		if scope, rest, ok := strings.Cut(m.Name, "/"); ok && strings.HasPrefix(scope, "@") {
+			group, name = scope, rest
+		}
+		byPURL[purl] = len(components)
+		components = append(components, cdxComponent{
+			Type:     "library",
+			BOMRef:   purl,
+			Group:    group,
+			Name:     name,
+			Version:  m.Version,
+			PURL:     purl,
+			Evidence: &cdxEvidence{Occurrences: []cdxOccurrence{occurrence}},
+		})
+	}
+
+	bom := cdxBOM{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.5",
+		SerialNumber: "urn:uuid:" + newUUID(),
+		Version:      1,
+		Metadata: cdxMetadata{
+			Timestamp: time.Now().UTC().Format(time.RFC3339),
+			Tools: cdxTools{Components: []cdxComponent{{
+				Type:    "application",
+				Name:    toolName,
+				Version: Version,
+			}}},
+		},
+		Components: components,
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(bom)
+}
+
+// newUUID returns a random (version 4) UUID
+func newUUID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "00000000-0000-4000-8000-000000000000"
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"maps"
+	"net/url"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/cschneider4711/quick-npm-module-scanner/scanner"
+)
+
+func TestWriteJSONShape(t *testing.T) {
+	match := func(root, name string) scanner.Match {
+		return scanner.Match{Name: name, Version: "1.0.0", Path: root + "/node_modules/" + name, Root: root, IOCMatched: true}
+	}
+	tests := []struct {
+		name    string
+		data    reportData
+		roots   int
+		matches int
+	}{
+		{"no matches", reportData{}, 0, 0},
+		{"one root", reportData{Matches: []scanner.Match{match("/a", "x")}}, 1, 1},
+		{"two roots", reportData{Matches: []scanner.Match{match("/a", "x"), match("/b", "x"), match("/b", "y")}, Grouped: true}, 2, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := writeJSON(&buf, tt.data); err != nil {
+				t.Fatal(err)
+			}
+			var report map[string]json.RawMessage
+			if err := json.Unmarshal(buf.Bytes(), &report); err != nil {
+				t.Fatal(err)
+			}
+			keys := slices.Sorted(maps.Keys(report))
+			if want := []string{"matches", "roots", "summary"}; !slices.Equal(keys, want) {
+				t.Errorf("keys = %v, want %v", keys, want)
+			}
+
+			var parsed struct {
+				Matches []scanner.Match
+				Roots   []struct {
+					Root  string
+					Count int
+				}
+			}
+			if err := json.Unmarshal(buf.Bytes(), &parsed); err != nil {
+				t.Fatal(err)
+			}
+			if len(parsed.Matches) != tt.matches || len(parsed.Roots) != tt.roots {
+				t.Errorf("%d matches, %d roots, want %d, %d", len(parsed.Matches), len(parsed.Roots), tt.matches, tt.roots)
+			}
+		})
+	}
+}
+
+func TestWriteSARIF(t *testing.T) {
+	root := t.TempDir()
+	abs := filepath.Join(root, "node_modules", "x")
+	type location struct {
+		PhysicalLocation struct {
+			ArtifactLocation struct {
+				URI       string `json:"uri"`
+				URIBaseID string `json:"uriBaseId"`
+			} `json:"artifactLocation"`
+			Region *struct {
+				StartLine int `json:"startLine"`
+			} `json:"region"`
+		} `json:"physicalLocation"`
+	}
+	type sarif struct {
+		Version string `json:"version"`
+		Runs    []struct {
+			Tool struct {
+				Driver struct {
+					Name  string `json:"name"`
+					Rules []struct {
+						ID string `json:"id"`
+					} `json:"rules"`
+				} `json:"driver"`
+			} `json:"tool"`
+			OriginalURIBaseIDs map[string]struct {
+				URI string `json:"uri"`
+			} `json:"originalUriBaseIds"`
+			Results []struct {
+				RuleID    string     `json:"ruleId"`
+				Level     string     `json:"level"`
+				Locations []location `json:"locations"`
+			} `json:"results"`
+		} `json:"runs"`
+	}
+	write := func(t *testing.T, data reportData) (sarif, map[string]any) {
+		t.Helper()
+		var buf bytes.Buffer
+		if err := writeSARIF(&buf, data); err != nil {
+			t.Fatal(err)
+		}
+		var doc sarif
+		var raw map[string]any
+		if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(buf.Bytes(), &raw); err != nil {
+			t.Fatal(err)
+		}
+		if doc.Version != "2.1.0" || len(doc.Runs) != 1 || doc.Runs[0].Tool.Driver.Name != toolName {
+			t.Fatalf("version %q, %d runs, want one 2.1.0 run by %s", doc.Version, len(doc.Runs), toolName)
+		}
+		return doc, raw
+	}
+
+	t.Run("no matches", func(t *testing.T) {
+		_, raw := write(t, reportData{Matches: []scanner.Match{{Name: "x", Version: "1.0.0", Path: abs, Source: scanner.SourceInstalled}}})
+		run := raw["runs"].([]any)[0].(map[string]any)
+		results, ok := run["results"].([]any)
+		if !ok || len(results) != 0 {
+			t.Errorf("results = %v, want an empty array", run["results"])
+		}
+	})
+
+	t.Run("absolute paths", func(t *testing.T) {
+		doc, _ := write(t, reportData{Matches: []scanner.Match{
+			{Name: "x", Version: "1.0.0", Path: abs, Root: root, Source: scanner.SourceInstalled, IOCMatched: true},
+			{Name: "x", Version: "1.0.0", Path: abs, Root: root, Source: scanner.SourceInstalled, IOCMatched: true, Baselined: true},
+		}})
+		run := doc.Runs[0]
+		if len(run.Results) != 2 || len(run.Tool.Driver.Rules) != 1 || run.OriginalURIBaseIDs != nil {
+			t.Fatalf("%d results, %d rules, base IDs %v", len(run.Results), len(run.Tool.Driver.Rules), run.OriginalURIBaseIDs)
+		}
+		if run.Results[0].Level != "error" || run.Results[1].Level != "note" {
+			t.Errorf("levels %s, %s, want error, note", run.Results[0].Level, run.Results[1].Level)
+		}
+		loc := run.Results[0].Locations[0].PhysicalLocation.ArtifactLocation
+		u, err := url.Parse(loc.URI)
+		if err != nil || u.Scheme != "file" || loc.URIBaseID != "" {
+			t.Fatalf("uri %q (base %q), want a file URI", loc.URI, loc.URIBaseID)
+		}
+		if want := filepath.ToSlash(filepath.Join(abs, "package.json")); !strings.HasSuffix(u.Path, want) {
+			t.Errorf("uri path %q, want %q", u.Path, want)
+		}
+	})
+
+	t.Run("relative to scan roots", func(t *testing.T) {
+		other := filepath.Join(root, "other")
+		doc, _ := write(t, reportData{Matches: []scanner.Match{
+			{Name: "x", Version: "1.0.0", Path: "node_modules/x", Root: root, Source: scanner.SourceInstalled, IOCMatched: true},
+			{Name: "y", Version: "1.0.0", Path: "src/a.js", Line: 3, Root: other, Source: scanner.SourceContent, IOCMatched: true},
+		}})
+		run := doc.Runs[0]
+		var got []string
+		for _, r := range run.Results {
+			loc := r.Locations[0].PhysicalLocation.ArtifactLocation
+			got = append(got, loc.URIBaseID+" "+loc.URI)
+		}
+		if want := []string{"ROOT1 node_modules/x/package.json", "ROOT2 src/a.js"}; !slices.Equal(got, want) {
+			t.Errorf("locations %q, want %q", got, want)
+		}
+		if r := run.Results[1].Locations[0].PhysicalLocation.Region; r == nil || r.StartLine != 3 {
+			t.Errorf("region = %v, want line 3", r)
+		}
+		if base := run.OriginalURIBaseIDs["ROOT2"].URI; base != fileURI(other)+"/" {
+			t.Errorf("ROOT2 = %q, want %q", base, fileURI(other)+"/")
+		}
+	})
+
+	t.Run("relative to a directory", func(t *testing.T) {
+		doc, _ := write(t, reportData{RelativeTo: root, Matches: []scanner.Match{
+			{Name: "x", Version: "1.0.0", Path: "node_modules/x", Root: root, Source: scanner.SourceInstalled, IOCMatched: true},
+		}})
+		loc := doc.Runs[0].Results[0].Locations[0].PhysicalLocation.ArtifactLocation
+		if loc.URIBaseID != srcRootID || doc.Runs[0].OriginalURIBaseIDs[srcRootID].URI != fileURI(root)+"/" {
+			t.Errorf("location %+v, base IDs %v", loc, doc.Runs[0].OriginalURIBaseIDs)
+		}
+	})
+}
+
+func TestFileURI(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		if got := fileURI(`C:\proj\node_modules\x`); got != "file:///C:/proj/node_modules/x" {
+			t.Errorf("fileURI = %q", got)
+		}
+		return
+	}
+	if got := fileURI("/srv/my app/node_modules/x"); got != "file:///srv/my%20app/node_modules/x" {
+		t.Errorf("fileURI = %q", got)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// progressInterval is how often the progress line is refreshed
+const progressInterval = 200 * time.Millisecond
+
+// progress periodically rewrites a "checked/total (percent)" status line
+// while a scan runs
+type progress struct {
+	w       io.Writer
+	total   int
+	checked atomic.Int64
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// startProgress starts refreshing the status line for total files
+func startProgress(w io.Writer, total int) *progress {
+	p := &progress{w: w, total: total, done: make(chan struct{}), stopped: make(chan struct{})}
+	go func() {
+		defer close(p.stopped)
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.print()
+			case <-p.done:
+				// Clear the status line so it doesn't mix with the report
+				fmt.Fprint(p.w, "\r\x1b[K")
+				return
+			}
+		}
+	}()
+	return p
+}
+
+// add records one checked file
+func (p *progress) add() {
+	p.checked.Add(1)
+}
+
+// print writes the current status line
+func (p *progress) print() {
+	checked := int(p.checked.Load())
+	percent := 100
+	if p.total > 0 {
+		percent = min(checked*100/p.total, 100)
+	}
+	fmt.Fprintf(p.w, "\r\x1b[KChecked %d/%d files (%d%%)", checked, p.total, percent)
+}
+
+// stop stops refreshing and clears the status line
+func (p *progress) stop() {
+	close(p.done)
+	<-p.stopped
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/cschneider4711/quick-npm-module-scanner/scanner"
+)
+
+// pathRewriter shortens the paths of a report to be relative to the scan
+// root they were found under (-relative-paths) or to a fixed directory
+// (-relative-to). Matching is done on the absolute paths the scanner
+// reports, after baselines were applied.
+type pathRewriter struct {
+	roots  []string // scan roots, longest first so nested roots win
+	byRoot bool     // rewrite match paths relative to the match's own root
+}
+
+// newPathRewriter returns a rewriter relative to the given scan roots, or
+// to a single directory when given just that
+func newPathRewriter(roots []string) *pathRewriter {
+	r := &pathRewriter{roots: append([]string(nil), roots...)}
+	sort.Slice(r.roots, func(i, j int) bool {
+		return len(r.roots[i]) > len(r.roots[j])
+	})
+	return r
+}
+
+// rewrite returns p relative to the root containing it, or p itself (the
+// absolute path) if no root does
+func (r *pathRewriter) rewrite(p string) string {
+	for _, root := range r.roots {
+		if rel, ok := relativeBelow(root, p); ok {
+			return rel
+		}
+	}
+	return p
+}
+
+// match rewrites the paths of a single match
+func (r *pathRewriter) match(m *scanner.Match) {
+	rewrite := r.rewrite
+	if r.byRoot && m.Root != "" {
+		// Roots can overlap, so the longest one containing a path is not
+		// necessarily the root the match was reported under
+		rewrite = func(p string) string {
+			if rel, ok := relativeBelow(m.Root, p); ok {
+				return rel
+			}
+			return r.rewrite(p)
+		}
+	}
+	m.Path = rewrite(m.Path)
+	for i, p := range m.Paths {
+		m.Paths[i] = rewrite(p)
+	}
+	if m.ModifiedFile != "" {
+		m.ModifiedFile = rewrite(m.ModifiedFile)
+	}
+}
+
+// report rewrites the paths of every list in a report
+func (r *pathRewriter) report(data *reportData) {
+	for _, list := range [][]scanner.Match{data.Matches, data.Suspicious, data.Unattested, data.Scored, data.Modified} {
+		for i := range list {
+			r.match(&list[i])
+		}
+	}
+	for i := range data.Writable {
+		data.Writable[i].Path = r.rewrite(data.Writable[i].Path)
+	}
+	for _, dup := range data.Duplicates {
+		for _, v := range dup.Versions {
+			for i, p := range v.Paths {
+				v.Paths[i] = r.rewrite(p)
+			}
+		}
+	}
+}
+
+// relativeBelow returns path relative to dir if it is dir itself or lies
+// below it
+func relativeBelow(dir, path string) (string, bool) {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || filepath.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return rel, true
+}
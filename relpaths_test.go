@@ -0,0 +1,35 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/cschneider4711/quick-npm-module-scanner/scanner"
+)
+
+func TestPathRewriter(t *testing.T) {
+	base := t.TempDir()
+	a, nested, b := filepath.Join(base, "a"), filepath.Join(base, "a", "x", "node_modules"), filepath.Join(base, "b")
+	r := newPathRewriter([]string{a, nested, b})
+	tests := []struct{ path, want string }{
+		{filepath.Join(a, "node_modules", "q"), filepath.Join("node_modules", "q")},
+		{filepath.Join(nested, "q"), "q"},
+		{b, "."},
+		{filepath.Join(base, "c", "q"), filepath.Join(base, "c", "q")},
+		{filepath.Join(base, "ab"), filepath.Join(base, "ab")},
+	}
+	for _, tt := range tests {
+		if got := r.rewrite(tt.path); got != tt.want {
+			t.Errorf("rewrite(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+
+	// With overlapping roots, a match is relative to the root it was
+	// reported under, not to the longest root containing it
+	r.byRoot = true
+	m := scanner.Match{Path: filepath.Join(nested, "q"), Root: a}
+	r.match(&m)
+	if want := filepath.Join("x", "node_modules", "q"); m.Path != want {
+		t.Errorf("match path = %q, want %q", m.Path, want)
+	}
+}
@@ -0,0 +1,33 @@
+package scanner
+
+import "strings"
+
+// npmAlias parses an npm alias specifier, "npm:real-name@range" as in
+// `"foo": "npm:evil@^1.0.0"` (installed as foo, but really evil), and
+// returns the real package name and range. A missing range means the latest
+// version and is returned as "*". Plain "npm:^1.0.0" specifiers (Yarn's
+// protocol prefix for a registry range) are not aliases.
+func npmAlias(spec string) (name, rng string, ok bool) {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(spec), "npm:")
+	if !ok || rest == "" {
+		return "", "", false
+	}
+	// A name is told apart from a bare range by the "@" separating it from
+	// its range (past the leading "@" of a scoped name), or, without one,
+	// by not starting like a range
+	if at := strings.LastIndex(rest[1:], "@"); at >= 0 {
+		return rest[:at+1], orWildcard(rest[at+2:]), true
+	}
+	if strings.ContainsAny(rest[:1], "0123456789^~<>=*|") {
+		return "", "", false
+	}
+	return rest, "*", true
+}
+
+// orWildcard returns "*" for an empty range
+func orWildcard(rng string) string {
+	if rng == "" {
+		return "*"
+	}
+	return rng
+}
@@ -0,0 +1,73 @@
+package scanner
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestNpmAlias(t *testing.T) {
+	tests := []struct {
+		spec, name, rng string
+		ok              bool
+	}{
+		{"npm:evil@1.0.0", "evil", "1.0.0", true},
+		{"npm:evil@^1.0.0", "evil", "^1.0.0", true},
+		{"npm:@scope/evil@~2.1.0", "@scope/evil", "~2.1.0", true},
+		{"npm:@scope/evil", "@scope/evil", "*", true},
+		{"npm:evil", "evil", "*", true},
+		{"npm:evil@", "evil", "*", true},
+		{" npm:evil@1.0.0 ", "evil", "1.0.0", true},
+		{"npm:^1.0.0", "", "", false},
+		{"npm:1.0.0", "", "", false},
+		{"npm:", "", "", false},
+		{"^1.0.0", "", "", false},
+		{"github:user/evil", "", "", false},
+	}
+	for _, tt := range tests {
+		name, rng, ok := npmAlias(tt.spec)
+		if name != tt.name || rng != tt.rng || ok != tt.ok {
+			t.Errorf("npmAlias(%q) = %q, %q, %v, want %q, %q, %v", tt.spec, name, rng, ok, tt.name, tt.rng, tt.ok)
+		}
+	}
+}
+
+func TestScanAliasedPackage(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "package.json", `{
+  "name": "app",
+  "dependencies": {"foo": "npm:evil@^1.0.0", "bar": "npm:@scope/fine@2.0.0"},
+  "overrides": {"baz": "npm:evil@1.0.0"}
+}`)
+	// The installed alias directory is named foo, its package.json carries
+	// the real name
+	writeFile(t, dir, "node_modules/foo/package.json", `{"name": "evil", "version": "1.0.0"}`)
+	writeFile(t, dir, "package-lock.json", `{
+  "lockfileVersion": 3,
+  "packages": {
+    "node_modules/foo": {"name": "evil", "version": "1.0.0"}
+  }
+}`)
+
+	result, err := Scan(Options{
+		Roots:     []string{dir},
+		IOCs:      mustLoadIOCs(t, "evil,1.0.0\nfoo,*\n"),
+		CheckDeps: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, m := range result.Matches {
+		got = append(got, string(m.Source)+" "+m.Name+"@"+m.Version)
+	}
+	slices.Sort(got)
+	want := []string{
+		"declared evil@^1.0.0",
+		"installed evil@1.0.0",
+		"lockfile evil@1.0.0",
+		"override evil@1.0.0",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("matches = %q, want %q", got, want)
+	}
+}
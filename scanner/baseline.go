@@ -0,0 +1,95 @@
+package scanner
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Baseline holds previously triaged matches, as written by the JSON output
+// format (a report object or a plain array of matches), so that they can be
+// told apart from new ones
+type Baseline struct {
+	keys       map[string]bool
+	ignorePath bool
+}
+
+// LoadBaseline reads a baseline from a JSON match list. If ignorePath is
+// set, matches are compared by name and version only, so a known package
+// stays known when it moves to another directory.
+func LoadBaseline(path string, ignorePath bool) (*Baseline, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open baseline file: %w", err)
+	}
+	defer file.Close()
+
+	return ReadBaseline(file, ignorePath)
+}
+
+// ReadBaseline reads a baseline from a JSON report or match list
+func ReadBaseline(r io.Reader, ignorePath bool) (*Baseline, error) {
+	matches, err := readReportMatches(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse baseline: %w", err)
+	}
+
+	b := &Baseline{keys: make(map[string]bool), ignorePath: ignorePath}
+	for _, m := range matches {
+		b.keys[b.key(m.Name, m.Version, m.Path)] = true
+		// Deduplicated reports list every location in Paths
+		for _, p := range m.Paths {
+			b.keys[b.key(m.Name, m.Version, p)] = true
+		}
+	}
+	return b, nil
+}
+
+// readReportMatches reads the matches of a JSON report (flat or grouped by
+// root) or of a plain array of matches
+func readReportMatches(r io.Reader) ([]Match, error) {
+	var raw json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, err
+	}
+
+	if trimmed := bytes.TrimSpace(raw); len(trimmed) == 0 || trimmed[0] != '{' {
+		var matches []Match
+		err := json.Unmarshal(raw, &matches)
+		return matches, err
+	}
+
+	var report struct {
+		Matches []Match `json:"matches"`
+		Roots   []struct {
+			Matches []Match `json:"matches"`
+		} `json:"roots"`
+	}
+	if err := json.Unmarshal(raw, &report); err != nil {
+		return nil, err
+	}
+	matches := report.Matches
+	for _, root := range report.Roots {
+		matches = append(matches, root.Matches...)
+	}
+	return matches, nil
+}
+
+// Len returns the number of distinct baseline entries
+func (b *Baseline) Len() int {
+	return len(b.keys)
+}
+
+// Contains reports whether the match is listed in the baseline
+func (b *Baseline) Contains(m Match) bool {
+	return b.keys[b.key(m.Name, m.Version, m.Path)]
+}
+
+func (b *Baseline) key(name, version, path string) string {
+	if b.ignorePath {
+		return name + "," + version
+	}
+	return name + "," + version + "," + path
+}
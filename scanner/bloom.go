@@ -0,0 +1,56 @@
+package scanner
+
+// bloomMinEntries is the IOC set size from which lookups are fronted by a
+// bloom filter; smaller sets are fast enough with the maps alone
+const bloomMinEntries = 4096
+
+// nameFilter is a bloom filter over package names. It never reports a
+// present name as absent, but may report an absent name as present, so a
+// positive answer still needs the authoritative maps.
+type nameFilter struct {
+	bits []uint64
+	k    uint64 // number of hash functions
+}
+
+// newNameFilter sizes a filter for n names at roughly 1% false positives
+// (10 bits and 7 hash functions per name)
+func newNameFilter(n int) *nameFilter {
+	words := (n*10 + 63) / 64
+	return &nameFilter{bits: make([]uint64, max(words, 1)), k: 7}
+}
+
+// hashes returns the two hashes of name the k probe positions are derived
+// from (Kirsch-Mitzenmacher double hashing). The second is the first with
+// its halves swapped, not an independent hash, forced odd so that it is
+// never zero.
+func (f *nameFilter) hashes(name string) (uint64, uint64) {
+	// FNV-1a, inlined to avoid allocating a hash.Hash per lookup
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(name); i++ {
+		h ^= uint64(name[i])
+		h *= 1099511628211
+	}
+	return h, h>>32 | h<<32 | 1
+}
+
+func (f *nameFilter) add(name string) {
+	h1, h2 := f.hashes(name)
+	size := uint64(len(f.bits)) * 64
+	for i := uint64(0); i < f.k; i++ {
+		bit := (h1 + i*h2) % size
+		f.bits[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+// mayContain reports whether name may have been added
+func (f *nameFilter) mayContain(name string) bool {
+	h1, h2 := f.hashes(name)
+	size := uint64(len(f.bits)) * 64
+	for i := uint64(0); i < f.k; i++ {
+		bit := (h1 + i*h2) % size
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
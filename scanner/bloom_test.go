@@ -0,0 +1,113 @@
+package scanner
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// largeIOCText returns n flat IOC entries for the packages pkg-0 to pkg-<n-1>
+func largeIOCText(n int) string {
+	var b strings.Builder
+	for i := range n {
+		fmt.Fprintf(&b, "pkg-%d,1.0.%d\n", i, i%10)
+	}
+	return b.String()
+}
+
+func TestNameFilter(t *testing.T) {
+	f := newNameFilter(10000)
+	for i := range 10000 {
+		f.add(fmt.Sprintf("pkg-%d", i))
+	}
+	for i := range 10000 {
+		if name := fmt.Sprintf("pkg-%d", i); !f.mayContain(name) {
+			t.Fatalf("added name %s reported absent", name)
+		}
+	}
+	falsePositives := 0
+	for i := range 10000 {
+		if f.mayContain(fmt.Sprintf("other-%d", i)) {
+			falsePositives++
+		}
+	}
+	if falsePositives > 300 {
+		t.Errorf("%d false positives in 10000 lookups, want about 1%%", falsePositives)
+	}
+}
+
+func TestLookupWithFilter(t *testing.T) {
+	iocs := mustLoadIOCs(t, largeIOCText(bloomMinEntries)+"ranged,^2.0.0\nany,*\n")
+	if iocs.names == nil {
+		t.Fatal("no filter built for a large set")
+	}
+	for _, tt := range []struct {
+		name, version string
+		want          bool
+	}{
+		{"pkg-0", "1.0.0", true},
+		{"pkg-4095", "1.0.5", true},
+		{"pkg-4095", "1.0.6", false},
+		{"ranged", "2.3.0", true},
+		{"any", "0.0.1", true},
+		{"unlisted", "1.0.0", false},
+	} {
+		if got := iocs.Lookup(tt.name, tt.version) != nil; got != tt.want {
+			t.Errorf("Lookup(%q, %q) matched = %v, want %v", tt.name, tt.version, got, tt.want)
+		}
+	}
+}
+
+// BenchmarkLookupMiss compares lookups of packages listed in no entry, the
+// common case, in a large IOC set with and without the bloom filter
+func BenchmarkLookupMiss(b *testing.B) {
+	iocs := mustLoadIOCs(b, largeIOCText(200000))
+	names := make([]string, 1024)
+	for i := range names {
+		names[i] = fmt.Sprintf("installed-%d", i)
+	}
+
+	filter := iocs.names
+	for _, bc := range []struct {
+		name   string
+		filter *nameFilter
+	}{{"bloom", filter}, {"maps", nil}} {
+		b.Run(bc.name, func(b *testing.B) {
+			iocs.names = bc.filter
+			b.ReportAllocs()
+			i := 0
+			for b.Loop() {
+				iocs.Lookup(names[i%len(names)], "1.0.0")
+				i++
+			}
+		})
+	}
+	iocs.names = filter
+}
+
+// BenchmarkScanLargeIOCSet scans a synthetic tree of 3000 installed
+// packages, none of them listed, against 200000 IOC entries with and
+// without the bloom filter
+func BenchmarkScanLargeIOCSet(b *testing.B) {
+	dir := b.TempDir()
+	for i := range 3000 {
+		writePackage(b, dir, fmt.Sprintf("installed-%d", i), "1.0.0")
+	}
+	iocs := mustLoadIOCs(b, largeIOCText(200000))
+
+	filter := iocs.names
+	for _, bc := range []struct {
+		name   string
+		filter *nameFilter
+	}{{"bloom", filter}, {"maps", nil}} {
+		b.Run(bc.name, func(b *testing.B) {
+			iocs.names = bc.filter
+			for b.Loop() {
+				if _, err := Scan(Options{Roots: []string{dir}, IOCs: iocs}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+	iocs.names = filter
+}
@@ -0,0 +1,88 @@
+package scanner
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// errBinaryLockfile is returned for Bun's binary bun.lockb, whose format
+// is not documented
+var errBinaryLockfile = errors.New("binary bun.lockb lockfiles cannot be parsed; run `bun install --save-text-lockfile` to write a text bun.lock")
+
+// bunLock represents the parts of a text bun.lock we need. Its "packages"
+// map is keyed by install path ("lodash", "foo/lodash", "foo/@scope/bar"),
+// and each entry is an array starting with the resolved "name@version":
+//
+//	"lodash": ["lodash@4.17.21", "", {...}, "sha512-..."],
+//
+// The file is JSON with trailing commas (JSONC).
+type bunLock struct {
+	Packages map[string][]json.RawMessage `json:"packages"`
+}
+
+// parseBunLock extracts the packages resolved in a text bun.lock
+func parseBunLock(path string) ([]lockedPackage, error) {
+	data, err := readFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var lock bunLock
+	if err := json.Unmarshal(stripJSONExtensions(data), &lock); err != nil {
+		return nil, err
+	}
+
+	var pkgs []lockedPackage
+	for key, entry := range lock.Packages {
+		if len(entry) == 0 {
+			continue
+		}
+		var spec string
+		if err := json.Unmarshal(entry[0], &spec); err != nil {
+			continue
+		}
+		name := packageNameFromSpec(spec)
+		version := strings.TrimPrefix(spec, name+"@")
+		// Workspace, git, file and link entries have no registry version
+		if name == "" || version == "" || strings.Contains(version, ":") {
+			continue
+		}
+		pkg := lockedPackage{Name: name, Version: version, Chain: bunChain(key)}
+		if len(entry) >= 4 {
+			var integrity string
+			if json.Unmarshal(entry[3], &integrity) == nil && isIntegrity(integrity) {
+				pkg.Integrity = integrity
+			}
+		}
+		pkgs = append(pkgs, pkg)
+	}
+	return pkgs, nil
+}
+
+// bunChain splits a bun.lock install path ("foo/@scope/bar") into the
+// package names along it
+func bunChain(key string) []string {
+	var chain []string
+	segments := strings.Split(key, "/")
+	for i := 0; i < len(segments); i++ {
+		name := segments[i]
+		if strings.HasPrefix(name, "@") && i+1 < len(segments) {
+			i++
+			name += "/" + segments[i]
+		}
+		chain = append(chain, name)
+	}
+	return chain
+}
+
+// parseBunLockb reports that a binary bun.lockb cannot be parsed, unless a
+// text bun.lock next to it (written by Bun 1.2+ during the migration)
+// covers the same packages
+func parseBunLockb(path string) ([]lockedPackage, error) {
+	if _, err := os.Stat(filepath.Join(filepath.Dir(path), "bun.lock")); err == nil {
+		return nil, nil
+	}
+	return nil, errBinaryLockfile
+}
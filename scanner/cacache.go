@@ -0,0 +1,110 @@
+package scanner
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// npm's download cache (~/.npm/_cacache, see the cacache package) is laid
+// out as follows; only the index is read:
+//
+//	index-v5/<2 hex>/<2 hex>/<hex>  bucket files of index entries, one per
+//	                                line as "<sha1 of json>\t<json>"
+//	content-v2/<algo>/...           the cached data, addressed by integrity
+//	tmp/                            partial downloads
+//
+// An index entry's key is the request it caches, e.g.
+// "make-fetch-happen:request-cache:https://registry.npmjs.org/a/-/a-1.0.0.tgz",
+// and its integrity the hash of the tarball. Entries for anything other than
+// package tarballs (packuments, audit requests) are skipped, and so are
+// lines that do not parse, so a changed format yields fewer entries rather
+// than errors.
+
+// cacacheDir is the name of npm's cache directory
+const cacacheDir = "_cacache"
+
+// cacacheSkipped lists cache subdirectories holding nothing to check
+var cacacheSkipped = map[string]bool{"content-v2": true, "tmp": true}
+
+// cacacheEntry is one line of an index bucket
+type cacacheEntry struct {
+	Key       string `json:"key"`
+	Integrity string `json:"integrity"` // null for deleted entries
+}
+
+// isCacacheIndex reports whether path is an index bucket of an npm cache
+func isCacacheIndex(path string) bool {
+	sep := string(filepath.Separator)
+	return strings.Contains(path, sep+cacacheDir+sep+"index-v5"+sep)
+}
+
+// isCacacheSkipped reports whether dir is a cache subdirectory that is
+// not walked, such as the content store
+func isCacacheSkipped(dir string) bool {
+	return cacacheSkipped[filepath.Base(dir)] && filepath.Base(filepath.Dir(dir)) == cacacheDir
+}
+
+// parseCacacheIndex extracts the cached package tarballs from an index bucket
+func parseCacacheIndex(path string) ([]lockedPackage, error) {
+	file, err := openFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var pkgs []lockedPackage
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		_, data, ok := strings.Cut(scanner.Text(), "\t")
+		if !ok {
+			continue
+		}
+		var entry cacacheEntry
+		if err := json.Unmarshal([]byte(data), &entry); err != nil || entry.Integrity == "" {
+			continue
+		}
+		if name, version, ok := tarballURLPackage(entry.Key); ok {
+			pkgs = append(pkgs, lockedPackage{Name: name, Version: version, Integrity: entry.Integrity})
+		}
+	}
+	return pkgs, scanner.Err()
+}
+
+// tarballURLPackage extracts the package name and version from a cache key
+// or URL of a registry tarball, "<registry>/<name>/-/<basename>-<version>.tgz"
+// (the registry may have a path prefix, and scoped names may be escaped as
+// "@scope%2fname")
+func tarballURLPackage(key string) (name, version string, ok bool) {
+	if i := strings.Index(key, "://"); i >= 0 {
+		if j := strings.LastIndex(key[:i], ":"); j >= 0 {
+			key = key[j+1:]
+		}
+	}
+	u, err := url.Parse(key)
+	if err != nil || !strings.HasSuffix(u.Path, ".tgz") {
+		return "", "", false
+	}
+	dir, file, ok := strings.Cut(u.Path, "/-/")
+	if !ok || strings.Contains(file, "/") {
+		return "", "", false
+	}
+
+	segments := strings.Split(strings.Trim(dir, "/"), "/")
+	name = segments[len(segments)-1]
+	if len(segments) > 1 && strings.HasPrefix(segments[len(segments)-2], "@") {
+		name = segments[len(segments)-2] + "/" + name
+	}
+	base := name
+	if _, unscoped, scoped := strings.Cut(name, "/"); scoped {
+		base = unscoped
+	}
+	version, ok = strings.CutPrefix(strings.TrimSuffix(file, ".tgz"), base+"-")
+	if !ok || version == "" || name == "" {
+		return "", "", false
+	}
+	return name, version, true
+}
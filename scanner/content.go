@@ -0,0 +1,185 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ContentRule is a signature searched for in the source files of installed
+// packages, e.g. a known exfiltration domain, to catch repackaged malware
+// that no name and version IOC lists
+type ContentRule struct {
+	Name    string
+	Pattern string // as listed: a literal string, or a "regex:" expression
+
+	literal []byte
+	re      *regexp.Regexp
+	where   string // location in the rules file, e.g. "line 3 of rules.txt"
+}
+
+// binarySniffLen is how many leading bytes are checked for a NUL byte to
+// tell binary files apart from source files
+const binarySniffLen = 8000
+
+// isSourceFile reports whether a file name is a JavaScript source file
+func isSourceFile(name string) bool {
+	switch filepath.Ext(name) {
+	case ".js", ".cjs", ".mjs":
+		return true
+	}
+	return false
+}
+
+// LoadContentRules reads content rules from a file of "name,pattern"
+// lines, where the pattern is a literal string or, prefixed with "regex:",
+// a regular expression. It may contain commas itself, as only the first
+// comma separates it from the name. Unlike IOC files, a malformed line is
+// an error, since a silently dropped rule would go unnoticed.
+func LoadContentRules(path string) ([]ContentRule, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open content rules file: %w", err)
+	}
+	defer file.Close()
+	return parseContentRules(file, path)
+}
+
+// parseContentRules parses content rules; source names the input in errors
+func parseContentRules(r io.Reader, source string) ([]ContentRule, error) {
+	var rules []ContentRule
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		where := location(source, fmt.Sprintf("line %d", lineNum))
+		name, pattern, ok := strings.Cut(line, ",")
+		name, pattern = strings.TrimSpace(name), strings.TrimSpace(pattern)
+		if !ok || name == "" || pattern == "" {
+			return nil, fmt.Errorf("invalid content rule at %s: %s", where, line)
+		}
+		rule := ContentRule{Name: name, Pattern: pattern, where: where}
+		if expr, isRegex := strings.CutPrefix(pattern, regexPrefix); isRegex {
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid content rule pattern at %s: %w", where, err)
+			}
+			rule.re = re
+		} else {
+			rule.literal = []byte(pattern)
+		}
+		rules = append(rules, rule)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read content rules file: %w", err)
+	}
+	return rules, nil
+}
+
+// find returns the offset of the first occurrence of the rule in data, or -1
+func (r *ContentRule) find(data []byte) int {
+	if r.re != nil {
+		if loc := r.re.FindIndex(data); loc != nil {
+			return loc[0]
+		}
+		return -1
+	}
+	return bytes.Index(data, r.literal)
+}
+
+// packageDirOf returns the directory of the installed package containing
+// the file at path (the directory below the last node_modules, or two
+// below it for scoped packages), or "" if the file is in none
+func packageDirOf(path string) string {
+	parts := strings.Split(path, string(filepath.Separator))
+	for i := len(parts) - 2; i >= 0; i-- {
+		if parts[i] != "node_modules" {
+			continue
+		}
+		end := i + 2
+		if strings.HasPrefix(parts[i+1], "@") {
+			end++
+		}
+		// A file directly in node_modules (or a scope) is in no package
+		if end >= len(parts) {
+			return ""
+		}
+		return strings.Join(parts[:end], string(filepath.Separator))
+	}
+	return ""
+}
+
+// contentPackage returns the package.json of an installed package directory,
+// reading each package only once; nil if it cannot be read
+func (c *fileChecker) contentPackage(dir string) *PackageJSON {
+	if pkg, ok := c.contentPackages.Load(dir); ok {
+		return pkg.(*PackageJSON)
+	}
+	pkg, err := readPackageJSON(filepath.Join(dir, "package.json"), c.maxFileSize)
+	if err != nil {
+		pkg = nil
+	}
+	c.contentPackages.Store(dir, pkg)
+	return pkg
+}
+
+// checkContent searches a source file of an installed package for the
+// content rules and returns a match per rule found, at its first line.
+// Files larger than the size limit and binary files are skipped.
+func (c *fileChecker) checkContent(path string) []Match {
+	dir := packageDirOf(path)
+	if dir == "" {
+		return nil
+	}
+	pkg := c.contentPackage(dir)
+	if pkg == nil || !isIncluded(pkg.Name, c.include) {
+		return nil
+	}
+
+	file, err := openFile(path)
+	if err != nil {
+		debugf("cannot read %s: %v", path, err)
+		return nil
+	}
+	defer file.Close()
+	data, err := io.ReadAll(&io.LimitedReader{R: file, N: c.maxFileSize + 1})
+	if err != nil || int64(len(data)) > c.maxFileSize {
+		debugf("skipping source file %s: unreadable or larger than %d bytes", path, c.maxFileSize)
+		return nil
+	}
+	if bytes.IndexByte(data[:min(len(data), binarySniffLen)], 0) >= 0 {
+		return nil
+	}
+	c.counters.contentFiles.Add(1)
+
+	var matches []Match
+	for i := range c.contentRules {
+		rule := &c.contentRules[i]
+		offset := rule.find(data)
+		if offset < 0 {
+			continue
+		}
+		matches = append(matches, Match{
+			Name:         pkg.Name,
+			Version:      pkg.Version,
+			Path:         path,
+			Source:       SourceContent,
+			IOCMatched:   true,
+			Reason:       "content rule " + rule.Name,
+			MatchedRule:  rule.Name + "," + rule.Pattern,
+			RuleLocation: rule.where,
+			Line:         bytes.Count(data[:offset], []byte{'\n'}) + 1,
+			Chain:        installChain(dir),
+		})
+	}
+	return matches
+}
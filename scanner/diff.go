@@ -0,0 +1,68 @@
+package scanner
+
+import (
+	"fmt"
+	"os"
+)
+
+// LoadReportMatches reads the matches of a JSON report written by the JSON
+// output format, one match per location for deduplicated reports
+func LoadReportMatches(path string) ([]Match, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open report: %w", err)
+	}
+	defer file.Close()
+
+	matches, err := readReportMatches(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse report %s: %w", path, err)
+	}
+
+	var expanded []Match
+	for _, m := range matches {
+		if len(m.Paths) == 0 {
+			expanded = append(expanded, m)
+			continue
+		}
+		for _, p := range m.Paths {
+			located := m
+			located.Path = p
+			located.Paths = nil
+			expanded = append(expanded, located)
+		}
+	}
+	return expanded, nil
+}
+
+// DiffMatches compares two match lists by name, version and path and
+// returns the matches only in newer (added) and only in older (removed),
+// each sorted like SortMatches
+func DiffMatches(older, newer []Match) (added, removed []Match) {
+	key := func(m Match) string {
+		return m.Name + "," + m.Version + "," + m.Path
+	}
+	inOlder := make(map[string]bool, len(older))
+	for _, m := range older {
+		inOlder[key(m)] = true
+	}
+	inNewer := make(map[string]bool, len(newer))
+	for _, m := range newer {
+		k := key(m)
+		if !inNewer[k] && !inOlder[k] {
+			added = append(added, m)
+		}
+		inNewer[k] = true
+	}
+	seen := make(map[string]bool)
+	for _, m := range older {
+		k := key(m)
+		if !inNewer[k] && !seen[k] {
+			removed = append(removed, m)
+		}
+		seen[k] = true
+	}
+	SortMatches(added)
+	SortMatches(removed)
+	return added, removed
+}
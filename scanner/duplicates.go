@@ -0,0 +1,67 @@
+package scanner
+
+import (
+	"sort"
+	"strings"
+)
+
+// Duplicate is a package installed at more than one version
+type Duplicate struct {
+	Name     string             `json:"name"`
+	Versions []DuplicateVersion `json:"versions"`
+}
+
+// DuplicateVersion lists where one version of a duplicated package is installed
+type DuplicateVersion struct {
+	Version string   `json:"version"`
+	Paths   []string `json:"paths"`
+}
+
+// FindDuplicates returns the packages of an inventory (Result.Inventory)
+// that are installed at more than one version, sorted by name, with their
+// versions in ascending order
+func FindDuplicates(inventory []Match) []Duplicate {
+	paths := make(map[string]map[string][]string) // name -> version -> paths
+	for _, m := range inventory {
+		if m.Source != SourceInstalled {
+			continue
+		}
+		if paths[m.Name] == nil {
+			paths[m.Name] = make(map[string][]string)
+		}
+		paths[m.Name][m.Version] = append(paths[m.Name][m.Version], m.Path)
+	}
+
+	var dups []Duplicate
+	for name, versions := range paths {
+		if len(versions) < 2 {
+			continue
+		}
+		dup := Duplicate{Name: name}
+		for version, where := range versions {
+			sort.Strings(where)
+			dup.Versions = append(dup.Versions, DuplicateVersion{version, where})
+		}
+		sort.Slice(dup.Versions, func(i, j int) bool {
+			return compareVersions(dup.Versions[i].Version, dup.Versions[j].Version) < 0
+		})
+		dups = append(dups, dup)
+	}
+	sort.Slice(dups, func(i, j int) bool {
+		return dups[i].Name < dups[j].Name
+	})
+	return dups
+}
+
+// compareVersions orders versions by semver precedence, falling back to a
+// string comparison if either is not a valid version
+func compareVersions(a, b string) int {
+	va, okA := parseSemver(a)
+	vb, okB := parseSemver(b)
+	if okA && okB {
+		if c := va.compare(vb); c != 0 {
+			return c
+		}
+	}
+	return strings.Compare(a, b)
+}
@@ -0,0 +1,93 @@
+package scanner
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// isExcluded reports whether a path matches any of the exclude patterns.
+// Each pattern is matched against the base name as well as the full path.
+func isExcluded(p string, patterns []string) bool {
+	if len(patterns) == 0 {
+		return false
+	}
+	base := filepath.Base(p)
+	full := filepath.ToSlash(p)
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, base); ok {
+			return true
+		}
+		if matchPathGlob(filepath.ToSlash(pattern), full) {
+			return true
+		}
+	}
+	return false
+}
+
+// isIncluded reports whether a package name matches any of the include
+// patterns, or whether there are none. Patterns are globs, in which "*"
+// does not match the "/" of scoped names, so "@scope/*" selects a scope.
+func isIncluded(name string, patterns []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// hiddenDirsScanned lists hidden directories that hold installed packages
+// and are scanned even though other hidden directories are skipped
+var hiddenDirsScanned = map[string]bool{
+	".pnpm": true, // pnpm's virtual store, node_modules/.pnpm/<name>@<version>/node_modules/<name>
+	".yarn": true, // Yarn Berry, whose unplugged packages live in .yarn/unplugged
+}
+
+// isSkippedHidden reports whether a directory is skipped by default: hidden
+// directories such as node_modules/.bin (command shims), .cache or .git,
+// except those in hiddenDirsScanned. Scoped package directories start with
+// "@" and are never hidden.
+func isSkippedHidden(name string) bool {
+	return strings.HasPrefix(name, ".") && !hiddenDirsScanned[name]
+}
+
+// matchPathGlob matches a slash-separated path against a glob pattern in
+// which "**" matches any number of path segments (including none), so
+// "**/.cache/**" matches both "/home/u/.cache" and "/home/u/.cache/x/y".
+func matchPathGlob(pattern, p string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(p, "/"))
+}
+
+func matchSegments(pattern, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// Collapse consecutive "**" and try every possible split
+			rest := pattern[1:]
+			for len(rest) > 0 && rest[0] == "**" {
+				rest = rest[1:]
+			}
+			if len(rest) == 0 {
+				return true
+			}
+			for i := 0; i <= len(segments); i++ {
+				if matchSegments(rest, segments[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segments) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+			return false
+		}
+		pattern = pattern[1:]
+		segments = segments[1:]
+	}
+	return len(segments) == 0
+}
@@ -0,0 +1,113 @@
+package scanner
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestIsExcluded(t *testing.T) {
+	tests := []struct {
+		path     string
+		patterns []string
+		want     bool
+	}{
+		{"/home/u/.cache", []string{"**/.cache/**"}, true},
+		{"/home/u/.cache/x/node_modules", []string{"**/.cache/**"}, true},
+		{"/home/u/cache", []string{"**/.cache/**"}, false},
+		{"/home/u/project/node_modules", []string{"**/.cache/**"}, false},
+		{"/srv/app/dist", []string{"dist"}, true},
+		{"/srv/app/dist-old", []string{"dist"}, false},
+		{"/srv/app/dist-old", []string{"dist*"}, true},
+		{"/srv/app/build/out", []string{"/srv/app/build/*"}, true},
+		{"/srv/app/build", []string{"/srv/app/build/*"}, false},
+		{"/a/b/fixtures", []string{"**/fixtures"}, true},
+		{"/a/fixtures/b", []string{"**/fixtures"}, false},
+		{"/a/b/c", []string{"/a/**/c"}, true},
+		{"/a/c", []string{"/a/**/c"}, true},
+		{"/a/b", []string{"x", "b"}, true},
+		{"/a/b", nil, false},
+	}
+	for _, tt := range tests {
+		if got := isExcluded(tt.path, tt.patterns); got != tt.want {
+			t.Errorf("isExcluded(%q, %q) = %v, want %v", tt.path, tt.patterns, got, tt.want)
+		}
+	}
+}
+
+func TestMatchPathGlob(t *testing.T) {
+	tests := []struct {
+		pattern, path string
+		want          bool
+	}{
+		{"**", "/any/path", true},
+		{"**/**/x", "/a/x", true},
+		{"**/x/**", "/a/x", true},
+		{"**/x/**", "/a/x/y/z", true},
+		{"**/x/**", "/a/xy/z", false},
+		{"/a/*/c", "/a/b/c", true},
+		{"/a/*/c", "/a/b/b/c", false},
+		{"/a/?/c", "/a/b/c", true},
+	}
+	for _, tt := range tests {
+		if got := matchPathGlob(tt.pattern, tt.path); got != tt.want {
+			t.Errorf("matchPathGlob(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestWalkPrunesExcludedSubtrees(t *testing.T) {
+	dir := t.TempDir()
+	writePackage(t, dir, "kept", "1.0.0")
+	writeFile(t, dir, "home/.cache/tool/node_modules/cached/package.json", `{}`)
+	writeFile(t, dir, "dist/node_modules/built/package.json", `{}`)
+
+	var got []string
+	opts := Options{Exclude: []string{"**/.cache/**", "dist"}, ScanHidden: true}
+	err := walkFiles(context.Background(), dir, opts, nil, nil, func(path string) {
+		rel, _ := filepath.Rel(dir, path)
+		got = append(got, filepath.ToSlash(rel))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"node_modules/kept/package.json"}; !slices.Equal(got, want) {
+		t.Errorf("walked %v, want %v", got, want)
+	}
+}
+
+func TestWalkNeverExcludesRoot(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "dist")
+	writePackage(t, dir, "kept", "1.0.0")
+
+	var got []string
+	err := walkFiles(context.Background(), dir, Options{Exclude: []string{"dist"}}, nil, nil, func(path string) {
+		got = append(got, path)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 {
+		t.Errorf("walked %v, want the package below the root", got)
+	}
+}
+
+func TestIsIncluded(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		want     bool
+	}{
+		{"anything", nil, true},
+		{"@scope/pkg", []string{"@scope/*"}, true},
+		{"@other/pkg", []string{"@scope/*"}, false},
+		{"lodash", []string{"lod*"}, true},
+		{"@scope/lodash", []string{"lod*"}, false},
+	}
+	for _, tt := range tests {
+		if got := isIncluded(tt.name, tt.patterns); got != tt.want {
+			t.Errorf("isIncluded(%q, %q) = %v, want %v", tt.name, tt.patterns, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package scanner
+
+import "os"
+
+// statFileID reports no identity; visitedDirs falls back to os.SameFile
+func statFileID(os.FileInfo) (fileID, bool) {
+	return fileID{}, false
+}
@@ -0,0 +1,79 @@
+package scanner
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// DefaultMaxOpenFiles is the default Options.MaxOpenFiles, low enough for
+// the common ulimit of 256 open files
+const DefaultMaxOpenFiles = 64
+
+// openRetries bounds how often opening a file is retried while the process
+// is out of file descriptors
+const openRetries = 5
+
+// openFile opens a file for reading like os.Open, with long path support on
+// Windows. While the process or system is out of file descriptors (EMFILE,
+// ENFILE), e.g. under a low ulimit, it retries with a growing delay instead
+// of failing right away.
+func openFile(path string) (*os.File, error) {
+	delay := 10 * time.Millisecond
+	for attempt := 0; ; attempt++ {
+		file, err := os.Open(longPath(path))
+		if err == nil || attempt == openRetries || !isTooManyOpenFiles(err) {
+			return file, err
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// readFile reads a whole file like os.ReadFile, opening it with openFile
+func readFile(path string) ([]byte, error) {
+	file, err := openFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
+
+// isTooManyOpenFiles reports whether err means no file descriptor was left
+func isTooManyOpenFiles(err error) bool {
+	return errors.Is(err, syscall.EMFILE) || errors.Is(err, syscall.ENFILE)
+}
+
+// WriteFileAtomic writes data to a temporary file renamed over path, so
+// readers (or concurrent scans) see either the old or the new contents,
+// never a partial file. The file keeps the mode of the file it replaces, or
+// gets mode 0644 like a file created by os.WriteFile.
+func WriteFileAtomic(path string, data []byte) error {
+	mode := os.FileMode(0o644)
+	if fi, err := os.Stat(path); err == nil {
+		mode = fi.Mode().Perm()
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
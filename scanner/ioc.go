@@ -0,0 +1,937 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// IOC is a single indicator entry with optional metadata
+type IOC struct {
+	Name     string `json:"name"`
+	Version  string `json:"version"`
+	Severity string `json:"severity,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+
+	where string // location in its source (e.g. "line 3 of ioc.txt"), set when loaded
+}
+
+// Rule returns the entry in the "name,version" form of the IOC file, where
+// the version may be a range, "*" or an integrity hash
+func (i *IOC) Rule() string {
+	return i.Name + "," + i.Version
+}
+
+// Severity levels in ascending order
+var severityLevels = []string{"low", "medium", "high", "critical"}
+
+// ValidSeverity reports whether the severity is a known level
+func ValidSeverity(severity string) bool {
+	_, ok := severityRank(severity)
+	return ok
+}
+
+// severityRank returns the position of a severity in severityLevels and
+// whether it is a known level. "moderate" (as used by npm audit) is treated
+// as "medium".
+func severityRank(severity string) (int, bool) {
+	severity = strings.ToLower(strings.TrimSpace(severity))
+	if severity == "moderate" {
+		severity = "medium"
+	}
+	for i, level := range severityLevels {
+		if level == severity {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// MeetsSeverity reports whether a match severity is at or above the threshold.
+// Matches without a (known) severity are treated as critical, since an IOC
+// hit should never be silently downgraded.
+func MeetsSeverity(severity, threshold string) bool {
+	minRank, _ := severityRank(threshold)
+	rank, ok := severityRank(severity)
+	if !ok {
+		rank = len(severityLevels) - 1
+	}
+	return rank >= minRank
+}
+
+// rangeIOC is an IOC whose version is a semver range
+type rangeIOC struct {
+	r   semverRange
+	ioc *IOC
+}
+
+// patternIOC is an IOC whose name is a regular expression ("regex:..."); a
+// nil range matches every version
+type patternIOC struct {
+	re  *regexp.Regexp
+	r   semverRange
+	ioc *IOC
+}
+
+// regexPrefix marks IOC names that are regular expressions
+const regexPrefix = "regex:"
+
+// IOCSet holds the loaded IOC entries. Plain versions are stored for exact
+// lookup, semver range entries are kept per package name, and names listed
+// with a "*" version match every version of that package. Name patterns are
+// only consulted when none of these match.
+type IOCSet struct {
+	exact     map[iocKey]*IOC       // name and version -> entry
+	versions  map[string][]*IOC     // name -> exact entries, for range queries
+	ranges    map[string][]rangeIOC // name -> range entries
+	wildcards map[string]*IOC       // name -> entry
+	integrity map[string]*IOC       // "sha512-..." -> entry
+	patterns  []patternIOC
+	names     *nameFilter // names of all other entries, nil for small sets
+
+	ignoreBuild bool // exact keys and lookups ignore "+build" metadata
+	ignoreCase  bool // names are stored and looked up in lowercase
+}
+
+// newIOCSet creates an empty IOC set
+func newIOCSet() *IOCSet {
+	return &IOCSet{
+		exact:     make(map[iocKey]*IOC),
+		versions:  make(map[string][]*IOC),
+		ranges:    make(map[string][]rangeIOC),
+		wildcards: make(map[string]*IOC),
+		integrity: make(map[string]*IOC),
+	}
+}
+
+// Len returns the number of loaded IOC entries
+func (s *IOCSet) Len() int {
+	n := len(s.exact) + len(s.wildcards) + len(s.integrity) + len(s.patterns)
+	for _, r := range s.ranges {
+		n += len(r)
+	}
+	return n
+}
+
+// iocKey is the key of an exact entry in IOCSet.exact; unlike a formatted
+// "name,version" string it needs no allocation per lookup
+type iocKey struct {
+	Name, Version string
+}
+
+// buildFilter (re)builds the bloom filter over the entry names, once the
+// set is large enough to benefit from it
+func (s *IOCSet) buildFilter() {
+	s.names = nil
+	if s.Len() < bloomMinEntries {
+		return
+	}
+	s.names = newNameFilter(s.Len())
+	for key := range s.exact {
+		s.names.add(key.Name)
+	}
+	for name := range s.wildcards {
+		s.names.add(name)
+	}
+	for name := range s.ranges {
+		s.names.add(name)
+	}
+}
+
+// Lookup returns the IOC entry matching the given package name and version, or nil
+func (s *IOCSet) Lookup(name, version string) *IOC {
+	name = s.normalizeName(name)
+
+	// Most packages match no entry; the filter rules out their names
+	// before any map lookup
+	if s.names == nil || s.names.mayContain(name) {
+		if ioc := s.lookupName(name, version); ioc != nil {
+			return ioc
+		}
+	}
+	if len(s.patterns) == 0 {
+		return nil
+	}
+
+	v, ok := parseSemver(version)
+	for _, p := range s.patterns {
+		if !p.re.MatchString(name) {
+			continue
+		}
+		if p.r == nil || ok && p.r.contains(v) {
+			return p.ioc
+		}
+	}
+	return nil
+}
+
+// lookupName returns the exact, wildcard or range entry for a normalized
+// package name and version, or nil
+func (s *IOCSet) lookupName(name, version string) *IOC {
+	// Fast path: exact version match
+	if ioc := s.exact[iocKey{name, normalizeVersion(version, s.ignoreBuild)}]; ioc != nil {
+		return ioc
+	}
+
+	// Name-only entries match any version
+	if ioc := s.wildcards[name]; ioc != nil {
+		return ioc
+	}
+
+	ranges := s.ranges[name]
+	if len(ranges) == 0 {
+		return nil
+	}
+	v, ok := parseSemver(version)
+	if !ok {
+		return nil
+	}
+	for _, r := range ranges {
+		if r.r.contains(v) {
+			return r.ioc
+		}
+	}
+	return nil
+}
+
+// IgnoreBuildMetadata makes exact versions compare equal regardless of
+// SemVer build metadata, so "1.0.0+abc" matches an entry for "1.0.0" and
+// vice versa. Call it after loading and merging all entries.
+func (s *IOCSet) IgnoreBuildMetadata() {
+	s.ignoreBuild = true
+	exact := make(map[iocKey]*IOC, len(s.exact))
+	for key, ioc := range s.exact {
+		key.Version = normalizeVersion(ioc.Version, true)
+		if _, ok := exact[key]; !ok {
+			exact[key] = ioc
+		}
+	}
+	s.exact = exact
+}
+
+// IgnoreNameCase makes package names compare case-insensitively, so an
+// entry for "Foo" also matches an installed "foo" and vice versa. Versions
+// still compare case-sensitively. Call it after loading and merging all
+// entries.
+func (s *IOCSet) IgnoreNameCase() {
+	s.ignoreCase = true
+	exact := make(map[iocKey]*IOC, len(s.exact))
+	versions := make(map[string][]*IOC, len(s.versions))
+	for key, ioc := range s.exact {
+		key.Name = strings.ToLower(key.Name)
+		if _, ok := exact[key]; !ok {
+			exact[key] = ioc
+			versions[key.Name] = append(versions[key.Name], ioc)
+		}
+	}
+	s.exact, s.versions = exact, versions
+
+	wildcards := make(map[string]*IOC, len(s.wildcards))
+	for name, ioc := range s.wildcards {
+		if _, ok := wildcards[strings.ToLower(name)]; !ok {
+			wildcards[strings.ToLower(name)] = ioc
+		}
+	}
+	s.wildcards = wildcards
+
+	ranges := make(map[string][]rangeIOC, len(s.ranges))
+	for name, r := range s.ranges {
+		ranges[strings.ToLower(name)] = append(ranges[strings.ToLower(name)], r...)
+	}
+	s.ranges = ranges
+
+	// Patterns see the lowercased name; matching them case-insensitively
+	// keeps uppercase literals in them working
+	for i, p := range s.patterns {
+		s.patterns[i].re = regexp.MustCompile("(?i)" + p.re.String())
+	}
+	s.buildFilter()
+}
+
+// normalizeName canonicalizes a scanned package name for lookup in s
+func (s *IOCSet) normalizeName(name string) string {
+	name = normalizeName(name)
+	if s.ignoreCase {
+		name = strings.ToLower(name)
+	}
+	return name
+}
+
+// Merge adds the entries of other to s. Entries already present in s (same
+// name and version, range, wildcard or hash) are kept as they are.
+func (s *IOCSet) Merge(other *IOCSet) {
+	for key, ioc := range other.exact {
+		if _, ok := s.exact[key]; !ok {
+			s.exact[key] = ioc
+			s.versions[ioc.Name] = append(s.versions[ioc.Name], ioc)
+		}
+	}
+	for name, ioc := range other.wildcards {
+		if _, ok := s.wildcards[name]; !ok {
+			s.wildcards[name] = ioc
+		}
+	}
+	for hash, ioc := range other.integrity {
+		if _, ok := s.integrity[hash]; !ok {
+			s.integrity[hash] = ioc
+		}
+	}
+	for name, ranges := range other.ranges {
+	next:
+		for _, r := range ranges {
+			for _, existing := range s.ranges[name] {
+				if existing.ioc.Version == r.ioc.Version {
+					continue next
+				}
+			}
+			s.ranges[name] = append(s.ranges[name], r)
+		}
+	}
+nextPattern:
+	for _, p := range other.patterns {
+		for _, existing := range s.patterns {
+			if existing.ioc.Name == p.ioc.Name && existing.ioc.Version == p.ioc.Version {
+				continue nextPattern
+			}
+		}
+		s.patterns = append(s.patterns, p)
+	}
+	s.buildFilter()
+}
+
+// LookupDeclared returns an IOC entry for a version that a dependency
+// declaration (e.g. "^1.2.0" in package.json) allows, or nil. Declarations
+// that are not semver ranges (git URLs, tags, local paths) never match.
+func (s *IOCSet) LookupDeclared(name, declared string) *IOC {
+	name = s.normalizeName(name)
+	if s.names != nil && !s.names.mayContain(name) && len(s.patterns) == 0 {
+		return nil
+	}
+	if ioc := s.wildcards[name]; ioc != nil {
+		return ioc
+	}
+
+	r, err := parseSemverRange(declared)
+	if err != nil {
+		return nil
+	}
+	for _, ioc := range s.versions[name] {
+		if v, ok := parseSemver(ioc.Version); ok && r.contains(v) {
+			return ioc
+		}
+	}
+	for _, ri := range s.ranges[name] {
+		if r.overlaps(ri.r) {
+			return ri.ioc
+		}
+	}
+	for _, p := range s.patterns {
+		if p.re.MatchString(name) && (p.r == nil || r.overlaps(p.r)) {
+			return p.ioc
+		}
+	}
+	return nil
+}
+
+// hasIntegrity reports whether any integrity-based entries are loaded
+func (s *IOCSet) hasIntegrity() bool {
+	return len(s.integrity) > 0
+}
+
+// LookupIntegrity returns the IOC entry matching an npm integrity string, or
+// nil. The integrity may list several space-separated hashes.
+func (s *IOCSet) LookupIntegrity(integrity string) *IOC {
+	for _, hash := range strings.Fields(integrity) {
+		if ioc := s.integrity[hash]; ioc != nil {
+			return ioc
+		}
+	}
+	return nil
+}
+
+// normalizeName canonicalizes a package name so that equivalent spellings
+// from IOC feeds and from package.json files compare equal. It strips an
+// "npm:" or registry prefix (e.g. "https://registry.npmjs.org/"), restores
+// a missing "@" on scoped names ("scope/name") and lowercases scoped names,
+// which npm only allows in lowercase. Unscoped names keep their case, as
+// some legacy packages are published with uppercase letters.
+func normalizeName(name string) string {
+	name = strings.TrimSpace(name)
+	if !strings.ContainsAny(name, "/:") {
+		return name
+	}
+	name = strings.TrimPrefix(name, "npm:")
+	if _, rest, ok := strings.Cut(name, "://"); ok {
+		name = rest
+	}
+
+	// Drop registry host segments such as "registry.npmjs.org"
+	segments := strings.Split(strings.Trim(name, "/"), "/")
+	for len(segments) > 1 && !strings.HasPrefix(segments[0], "@") && strings.ContainsAny(segments[0], ".:") {
+		segments = segments[1:]
+	}
+
+	switch len(segments) {
+	case 1:
+		return segments[0]
+	case 2:
+		if !strings.HasPrefix(segments[0], "@") {
+			segments[0] = "@" + segments[0]
+		}
+		return strings.ToLower(segments[0] + "/" + segments[1])
+	}
+	return strings.Join(segments, "/")
+}
+
+// normalizeVersion canonicalizes a version so that spellings from IOC feeds
+// and from package.json files compare equal: it strips the leading "v" and
+// "=" characters parseSemver accepts (as in "=1.2.3" or "v=1.2.3") and, if
+// ignoreBuild is set, SemVer build metadata (a "+..." suffix)
+func normalizeVersion(version string, ignoreBuild bool) string {
+	version = strings.TrimSpace(version)
+	if trimmed := strings.TrimLeft(version, "vV="); trimmed != version && trimmed != "" && trimmed[0] >= '0' && trimmed[0] <= '9' {
+		version = trimmed
+	}
+	if ignoreBuild {
+		version, _, _ = strings.Cut(version, "+")
+	}
+	return version
+}
+
+// isIntegrity reports whether a version field is an npm integrity hash
+// (e.g. "sha512-<base64>") rather than a version
+func isIntegrity(version string) bool {
+	for _, prefix := range []string{"sha512-", "sha384-", "sha256-", "sha1-"} {
+		if strings.HasPrefix(version, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// IOCReport summarizes the problems found while loading an IOC source
+type IOCReport struct {
+	Entries    int      // valid entries, not counting duplicates
+	Malformed  []string // lines or entries that could not be parsed
+	Duplicates []string // entries listed more than once
+	BadRanges  []string // entries whose version range does not parse
+}
+
+// Problems returns the total number of problems found
+func (r *IOCReport) Problems() int {
+	return len(r.Malformed) + len(r.Duplicates) + len(r.BadRanges)
+}
+
+// iocLoader builds an IOCSet and tracks what is needed for load-time warnings
+type iocLoader struct {
+	set           *IOCSet
+	report        IOCReport
+	validating    bool              // only collect problems in report, without warnings
+	seen          map[string]string // "name,version" -> location of its first entry
+	wildcardAt    map[string]string // name -> location of its wildcard entry
+	specificNames []string          // names listed with a specific version or range, in file order
+}
+
+func newIOCLoader() *iocLoader {
+	return &iocLoader{
+		set:        newIOCSet(),
+		seen:       make(map[string]string),
+		wildcardAt: make(map[string]string),
+	}
+}
+
+// problem records a problem in list and warns about it unless validating
+func (l *iocLoader) problem(list *[]string, format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	*list = append(*list, msg)
+	if !l.validating {
+		warnf("%s\n", msg)
+	}
+}
+
+// add stores an entry; where describes its location (e.g. "line 3") for warnings
+func (l *iocLoader) add(ioc *IOC, where string) {
+	ioc.where = where
+	ioc.Version = normalizeVersion(ioc.Version, false)
+	if strings.HasPrefix(ioc.Name, regexPrefix) {
+		l.addPattern(ioc, where)
+		return
+	}
+	ioc.Name = normalizeName(ioc.Name)
+
+	// A bare "*" is kept separate from the exact entries, so it never
+	// collides with a (invalid) literal "*" version in a package.json
+	if ioc.Version == "*" {
+		if _, ok := l.wildcardAt[ioc.Name]; !ok {
+			l.wildcardAt[ioc.Name] = where
+		}
+		l.set.wildcards[ioc.Name] = ioc
+		l.count(ioc, where)
+		return
+	}
+
+	// Tarball hashes identify the package contents regardless of version
+	if isIntegrity(ioc.Version) {
+		l.set.integrity[ioc.Version] = ioc
+		l.count(ioc, where)
+		return
+	}
+
+	// Plain versions are stored by name and version for easy lookup
+	if _, ok := parseSemver(ioc.Version); ok {
+		key := iocKey{ioc.Name, ioc.Version}
+		if _, ok := l.set.exact[key]; !ok {
+			l.set.versions[ioc.Name] = append(l.set.versions[ioc.Name], ioc)
+		}
+		l.set.exact[key] = ioc
+		l.specificNames = append(l.specificNames, ioc.Name)
+		l.count(ioc, where)
+		return
+	}
+
+	r, err := parseSemverRange(ioc.Version)
+	if err != nil {
+		l.problem(&l.report.BadRanges, "unparseable version range at %s: %s,%s (%v)", where, ioc.Name, ioc.Version, err)
+		return
+	}
+	l.set.ranges[ioc.Name] = append(l.set.ranges[ioc.Name], rangeIOC{r, ioc})
+	l.specificNames = append(l.specificNames, ioc.Name)
+	l.count(ioc, where)
+}
+
+// addPattern stores an entry whose name is a regular expression. Its version
+// may be "*" or a version or range; integrity hashes are not supported.
+func (l *iocLoader) addPattern(ioc *IOC, where string) {
+	re, err := regexp.Compile(strings.TrimPrefix(ioc.Name, regexPrefix))
+	if err != nil {
+		l.problem(&l.report.Malformed, "invalid name pattern at %s: %s (%v)", where, ioc.Name, err)
+		return
+	}
+	p := patternIOC{re: re, ioc: ioc}
+	if ioc.Version != "*" {
+		if p.r, err = parseSemverRange(ioc.Version); err != nil {
+			l.problem(&l.report.BadRanges, "unparseable version range at %s: %s,%s (%v)", where, ioc.Name, ioc.Version, err)
+			return
+		}
+	}
+	l.set.patterns = append(l.set.patterns, p)
+	l.count(ioc, where)
+}
+
+// count records a stored entry in the report, as a duplicate if the same
+// name and version was stored before
+func (l *iocLoader) count(ioc *IOC, where string) {
+	key := ioc.Name + "," + ioc.Version
+	if first, ok := l.seen[key]; ok {
+		l.report.Duplicates = append(l.report.Duplicates,
+			fmt.Sprintf("duplicate entry at %s: %s (first listed at %s)", where, key, first))
+		return
+	}
+	l.seen[key] = where
+	l.report.Entries++
+}
+
+// finish emits cross-entry warnings and returns the built set
+func (l *iocLoader) finish() *IOCSet {
+	// Specific versions are redundant when the whole package is flagged
+	warned := make(map[string]bool)
+	for _, name := range l.specificNames {
+		if where, ok := l.wildcardAt[name]; ok && !warned[name] {
+			warned[name] = true
+			warnf("%s is listed with a wildcard version at %s and with specific versions; the wildcard covers all of them\n", name, where)
+		}
+	}
+	l.set.buildFilter()
+	return l.set
+}
+
+// isRemoteSource reports whether the IOC source is an HTTP(S) URL
+func isRemoteSource(source string) bool {
+	return strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://")
+}
+
+// LoadIOCs parses IOC entries from r, detecting the JSON or flat format from
+// the content
+func LoadIOCs(r io.Reader) (*IOCSet, error) {
+	loader := newIOCLoader()
+	if err := parseIOCs(r, "", loader); err != nil {
+		return nil, err
+	}
+	return loader.finish(), nil
+}
+
+// location describes where an entry was read for warnings, e.g. "line 3 of
+// ioc.txt", or just "line 3" if the source is unnamed
+func location(source, where string) string {
+	if source == "" {
+		return where
+	}
+	return where + " of " + source
+}
+
+// FetchOptions controls how IOC sources are read. All settings but SHA256
+// only apply to remote sources.
+type FetchOptions struct {
+	Timeout time.Duration // per request
+	Retries int           // further attempts after a 5xx status or network error
+	Backoff time.Duration // delay before the first retry, doubled for each further one
+
+	CacheDir string        // directory caching downloads, none if empty
+	CacheTTL time.Duration // age up to which a cached copy is used without asking the server
+
+	SHA256 string // expected hex SHA-256 of the source contents, unchecked if empty
+}
+
+// LoadIOCSource reads IOCs from a local file or an HTTP(S) URL
+func LoadIOCSource(source string, opts FetchOptions) (*IOCSet, error) {
+	loader := newIOCLoader()
+	if err := readIOCSource(source, opts, loader); err != nil {
+		return nil, err
+	}
+	return loader.finish(), nil
+}
+
+// ValidateIOCSource reads IOCs from a local file or an HTTP(S) URL like
+// LoadIOCSource, but reports the problems found instead of warning about
+// them. The error is only set if the source cannot be read at all.
+func ValidateIOCSource(source string, opts FetchOptions) (*IOCReport, error) {
+	loader := newIOCLoader()
+	loader.validating = true
+	if err := readIOCSource(source, opts, loader); err != nil {
+		return nil, err
+	}
+	return &loader.report, nil
+}
+
+// readIOCSource opens the source and parses it into loader
+func readIOCSource(source string, opts FetchOptions, loader *iocLoader) error {
+	var r io.ReadCloser
+	var err error
+	if isRemoteSource(source) {
+		r, err = fetchIOCs(source, opts)
+	} else {
+		r, err = os.Open(source)
+		if err != nil {
+			err = fmt.Errorf("failed to open IOC file: %w", err)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	if opts.SHA256 != "" {
+		return parseVerifiedIOCs(r, source, opts.SHA256, loader)
+	}
+	return parseIOCs(r, source, loader)
+}
+
+// parseVerifiedIOCs parses the IOCs in r only if the SHA-256 of its
+// contents matches want. The hash covers the bytes as stored, i.e. before
+// decompressing a gzip file (but after HTTP Content-Encoding), so it can be
+// pinned with the output of sha256sum.
+func parseVerifiedIOCs(r io.Reader, source, want string, loader *iocLoader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("failed to read IOC file: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	if got := hex.EncodeToString(sum[:]); !strings.EqualFold(got, want) {
+		return fmt.Errorf("SHA-256 mismatch: expected %s, got %s", strings.ToLower(want), got)
+	}
+	return parseIOCs(bytes.NewReader(data), source, loader)
+}
+
+// fetchIOCs downloads an IOC feed, transparently decoding gzip responses.
+// With a cache directory set, the download goes through the cache.
+func fetchIOCs(url string, opts FetchOptions) (io.ReadCloser, error) {
+	if opts.CacheDir != "" {
+		return fetchCachedIOCs(url, opts)
+	}
+	resp, err := requestIOCs(url, opts, nil)
+	if err != nil {
+		return nil, err
+	}
+	return decodeIOCResponse(resp)
+}
+
+// requestIOCs sends the request for an IOC feed. If a cached copy is
+// given, the request is conditional on its ETag and Last-Modified, so the
+// response may also be 304 Not Modified.
+func requestIOCs(url string, opts FetchOptions, cached *iocCacheMeta) (*http.Response, error) {
+	client := &http.Client{Timeout: opts.Timeout}
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid IOC URL: %w", err)
+	}
+	// Requesting gzip explicitly disables the transport's automatic
+	// decompression, so the body is decoded by decodeIOCResponse
+	req.Header.Set("Accept-Encoding", "gzip")
+	if cached != nil {
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+	return doWithRetries(client, req, opts, cached != nil)
+}
+
+// decodeIOCResponse returns the body of a successful IOC response,
+// decoding it if it is gzip-encoded
+func decodeIOCResponse(resp *http.Response) (io.ReadCloser, error) {
+	if strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			resp.Body.Close()
+			return nil, fmt.Errorf("failed to decode gzip IOC response: %w", err)
+		}
+		return readCloser{gz, resp.Body}, nil
+	}
+	return resp.Body, nil
+}
+
+// doWithRetries sends req and returns its 200 response, or a 304 response if
+// the request is conditional. Network errors and
+// 5xx statuses are retried up to opts.Retries times with exponential
+// backoff; other statuses fail right away, as repeating the request would
+// not change them.
+func doWithRetries(client *http.Client, req *http.Request, opts FetchOptions, conditional bool) (*http.Response, error) {
+	delay := opts.Backoff
+	for attempt := 0; ; attempt++ {
+		resp, err := client.Do(req)
+		transient := true
+		if err != nil {
+			err = fmt.Errorf("failed to fetch IOC URL: %w", err)
+		} else if resp.StatusCode != http.StatusOK && !(conditional && resp.StatusCode == http.StatusNotModified) {
+			resp.Body.Close()
+			transient = resp.StatusCode >= 500
+			err = fmt.Errorf("failed to fetch IOC URL: unexpected status %s", resp.Status)
+		} else {
+			return resp, nil
+		}
+		if !transient || attempt >= opts.Retries {
+			return nil, err
+		}
+		warnf("%v; retrying in %s (%d of %d)\n", err, delay, attempt+1, opts.Retries)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// readCloser pairs a decoding reader with the underlying body to close
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// parseIOCs parses IOC entries from r. Gzip-compressed input is detected
+// from its magic bytes and decompressed first. The format is detected from
+// the source name (".json", ".jsonl" or ".ndjson", optionally with ".gz")
+// or the first non-blank character ("[" or "{"); anything else is treated
+// as the flat "name,version" format.
+func parseIOCs(r io.Reader, source string, loader *iocLoader) error {
+	br := bufio.NewReader(r)
+	if isGzip(br) {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return fmt.Errorf("failed to decompress IOC file: %w", err)
+		}
+		defer gz.Close()
+		br = bufio.NewReader(gz)
+	}
+
+	name := strings.TrimSuffix(strings.ToLower(source), ".gz")
+	if strings.HasSuffix(name, ".jsonl") || strings.HasSuffix(name, ".ndjson") {
+		return parseJSONLinesIOCs(br, source, loader)
+	}
+	if strings.HasSuffix(name, ".json") || startsWithJSON(br) {
+		return parseJSONIOCs(br, source, loader)
+	}
+	return parseFlatIOCs(br, source, loader)
+}
+
+// isGzip peeks for the gzip magic bytes
+func isGzip(br *bufio.Reader) bool {
+	b, err := br.Peek(2)
+	return err == nil && b[0] == 0x1f && b[1] == 0x8b
+}
+
+// startsWithJSON peeks past leading whitespace for a JSON array or object
+func startsWithJSON(br *bufio.Reader) bool {
+	for i := 1; ; i++ {
+		b, err := br.Peek(i)
+		if err != nil {
+			return false
+		}
+		switch b[i-1] {
+		case ' ', '\t', '\r', '\n':
+			continue
+		case '[', '{':
+			return true
+		default:
+			return false
+		}
+	}
+}
+
+// parseJSONIOCs parses a JSON array of IOC objects, or an object holding
+// that array under "iocs" into loader. Input whose first line is an IOC
+// object of its own is parsed as JSON Lines. source names the input in
+// warnings.
+func parseJSONIOCs(r io.Reader, source string, loader *iocLoader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("failed to read IOC file: %w", err)
+	}
+	if isJSONLines(data) {
+		return parseJSONLinesIOCs(bytes.NewReader(data), source, loader)
+	}
+
+	var entries []*IOC
+	trimmed := strings.TrimSpace(string(data))
+	if strings.HasPrefix(trimmed, "{") {
+		var wrapper struct {
+			IOCs []*IOC `json:"iocs"`
+		}
+		err = json.Unmarshal(data, &wrapper)
+		entries = wrapper.IOCs
+	} else {
+		err = json.Unmarshal(data, &entries)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse JSON IOC file: %w", err)
+	}
+
+	for i, ioc := range entries {
+		if ioc == nil {
+			continue
+		}
+		addJSONIOC(loader, ioc, location(source, fmt.Sprintf("entry %d", i+1)))
+	}
+	return nil
+}
+
+// isJSONLines reports whether the first non-blank line of data is a JSON
+// object on its own, other than the {"iocs": [...]} wrapper
+func isJSONLines(data []byte) bool {
+	for line := range bytes.Lines(data) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal(line, &object); err != nil {
+			return false
+		}
+		_, wrapped := object["iocs"]
+		return !wrapped
+	}
+	return false
+}
+
+// parseJSONLinesIOCs parses one IOC object per line into loader, so large
+// feeds can be appended to. Lines that are not valid JSON are skipped with
+// a warning. source names the input in warnings.
+func parseJSONLinesIOCs(r io.Reader, source string, loader *iocLoader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		where := location(source, fmt.Sprintf("line %d", lineNum))
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var ioc IOC
+		if err := json.Unmarshal(line, &ioc); err != nil {
+			loader.problem(&loader.report.Malformed, "invalid JSON at %s: %v", where, err)
+			continue
+		}
+		addJSONIOC(loader, &ioc, where)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read IOC file: %w", err)
+	}
+	return nil
+}
+
+// addJSONIOC validates an IOC object read from JSON and adds it to loader
+func addJSONIOC(loader *iocLoader, ioc *IOC, where string) {
+	ioc.Name = strings.TrimSpace(ioc.Name)
+	ioc.Version = strings.TrimSpace(ioc.Version)
+	if ioc.Name == "" || ioc.Version == "" {
+		loader.problem(&loader.report.Malformed, "empty name or version at %s", where)
+		return
+	}
+	if _, ok := severityRank(ioc.Severity); ioc.Severity != "" && !ok {
+		loader.problem(&loader.report.Malformed, "unknown severity %q at %s, treating as critical", ioc.Severity, where)
+	}
+	loader.add(ioc, where)
+}
+
+// parseFlatIOCs parses "name,version" lines into loader. The name may be a
+// "regex:" pattern. The version field may be a plain version, an npm-style
+// semver range, "*" to match all versions of the package, or an npm
+// integrity hash ("sha512-<base64>"). An optional third field holds the
+// reason (e.g. a CVE), which is the rest of the line after the second
+// comma, commas included; there is no quoting. Patterns take no reason, as
+// they may contain commas themselves. source names the input in warnings.
+func parseFlatIOCs(r io.Reader, source string, loader *iocLoader) error {
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		where := location(source, fmt.Sprintf("line %d", lineNum))
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		// Parse format: package-name,version[,reason]. Name patterns may
+		// contain commas themselves, so they end at the last one.
+		parts := strings.SplitN(line, ",", 3)
+		if strings.HasPrefix(line, regexPrefix) {
+			parts = nil
+			if i := strings.LastIndex(line, ","); i >= 0 {
+				parts = []string{line[:i], line[i+1:]}
+			}
+		}
+		if len(parts) < 2 {
+			loader.problem(&loader.report.Malformed, "invalid format at %s: %s", where, line)
+			continue
+		}
+
+		name := strings.TrimSpace(parts[0])
+		version := strings.TrimSpace(parts[1])
+		reason := ""
+		if len(parts) == 3 {
+			reason = strings.TrimSpace(parts[2])
+		}
+
+		if name == "" || version == "" {
+			loader.problem(&loader.report.Malformed, "empty name or version at %s: %s", where, line)
+			continue
+		}
+
+		loader.add(&IOC{Name: name, Version: version, Reason: reason}, where)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read IOC file: %w", err)
+	}
+	return nil
+}
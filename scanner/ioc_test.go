@@ -0,0 +1,294 @@
+package scanner
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// mustLoadIOCs parses IOC entries from text or fails the test
+func mustLoadIOCs(t testing.TB, text string) *IOCSet {
+	t.Helper()
+	iocs, err := LoadIOCs(strings.NewReader(text))
+	if err != nil {
+		t.Fatalf("LoadIOCs: %v", err)
+	}
+	return iocs
+}
+
+func TestLoadIOCsFlat(t *testing.T) {
+	iocs := mustLoadIOCs(t, `evil,1.0.0
+ranged,>=2.0.0 <2.1.0
+caret,^3.1.0
+any,*
+reasoned,4.0.0,CVE-2024-1234, see advisory
+
+bad line without version
+`)
+	if got := iocs.Len(); got != 5 {
+		t.Errorf("Len() = %d, want 5", got)
+	}
+
+	tests := []struct {
+		name, version string
+		want          bool
+	}{
+		{"evil", "1.0.0", true},
+		{"evil", "1.0.1", false},
+		{"evil", "v1.0.0", true},
+		{"ranged", "2.0.5", true},
+		{"ranged", "2.1.0", false},
+		{"caret", "3.9.9", true},
+		{"caret", "4.0.0", false},
+		{"any", "0.0.1", true},
+		{"any", "not-a-version", true},
+		{"reasoned", "4.0.0", true},
+		{"unlisted", "1.0.0", false},
+	}
+	for _, tt := range tests {
+		if got := iocs.Lookup(tt.name, tt.version) != nil; got != tt.want {
+			t.Errorf("Lookup(%q, %q) matched = %v, want %v", tt.name, tt.version, got, tt.want)
+		}
+	}
+
+	if ioc := iocs.Lookup("reasoned", "4.0.0"); ioc == nil || ioc.Reason != "CVE-2024-1234, see advisory" {
+		t.Errorf("reason = %+v, want the rest of the line", ioc)
+	}
+}
+
+func TestLoadIOCsJSON(t *testing.T) {
+	iocs := mustLoadIOCs(t, `[
+  {"name": "x", "version": "1.0.0", "severity": "high", "reason": "CVE-2024-1234"},
+  {"name": "y", "version": "*"}
+]`)
+	ioc := iocs.Lookup("x", "1.0.0")
+	if ioc == nil {
+		t.Fatal("x@1.0.0 not matched")
+	}
+	if ioc.Severity != "high" || ioc.Reason != "CVE-2024-1234" {
+		t.Errorf("metadata = %q, %q, want high, CVE-2024-1234", ioc.Severity, ioc.Reason)
+	}
+	if iocs.Lookup("y", "9.9.9") == nil {
+		t.Error("y@9.9.9 not matched by wildcard")
+	}
+}
+
+func TestLoadIOCsJSONLines(t *testing.T) {
+	iocs := mustLoadIOCs(t, `{"name": "a", "version": "1.0.0"}
+{"name": "b", "version": "2.0.0"}
+`)
+	if iocs.Lookup("a", "1.0.0") == nil || iocs.Lookup("b", "2.0.0") == nil {
+		t.Error("JSON Lines entries not matched")
+	}
+}
+
+func TestLookupIntegrity(t *testing.T) {
+	iocs := mustLoadIOCs(t, "evil,sha512-abc==\n")
+	if iocs.LookupIntegrity("sha1-xyz sha512-abc==") == nil {
+		t.Error("integrity listed among several hashes not matched")
+	}
+	if iocs.LookupIntegrity("sha512-other==") != nil {
+		t.Error("unrelated integrity matched")
+	}
+}
+
+func TestLookupPattern(t *testing.T) {
+	iocs := mustLoadIOCs(t, "regex:^evilcorp-.*,*\nregex:^bad-,<2.0.0\n")
+	tests := []struct {
+		name, version string
+		want          bool
+	}{
+		{"evilcorp-utils", "1.0.0", true},
+		{"not-evilcorp-utils", "1.0.0", false},
+		{"bad-thing", "1.5.0", true},
+		{"bad-thing", "2.0.0", false},
+	}
+	for _, tt := range tests {
+		if got := iocs.Lookup(tt.name, tt.version) != nil; got != tt.want {
+			t.Errorf("Lookup(%q, %q) matched = %v, want %v", tt.name, tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestLookupDeclared(t *testing.T) {
+	iocs := mustLoadIOCs(t, "evil,1.2.3\nranged,>=5.0.0 <5.1.0\n")
+	tests := []struct {
+		name, declared string
+		want           bool
+	}{
+		{"evil", "^1.0.0", true},
+		{"evil", "~1.3.0", false},
+		{"evil", "1.2.3", true},
+		{"ranged", "^5.0.5", true},
+		{"ranged", "^4.0.0", false},
+		{"evil", "github:user/evil", false},
+	}
+	for _, tt := range tests {
+		if got := iocs.LookupDeclared(tt.name, tt.declared) != nil; got != tt.want {
+			t.Errorf("LookupDeclared(%q, %q) matched = %v, want %v", tt.name, tt.declared, got, tt.want)
+		}
+	}
+}
+
+func TestValidateIOCs(t *testing.T) {
+	loader := newIOCLoader()
+	loader.validating = true
+	text := "ok,1.0.0\nmissing-version\nbad,=>1\nok,1.0.0\n"
+	if err := parseIOCs(strings.NewReader(text), "ioc.txt", loader); err != nil {
+		t.Fatal(err)
+	}
+	report := loader.report
+	if report.Entries != 1 {
+		t.Errorf("Entries = %d, want 1", report.Entries)
+	}
+	if len(report.Malformed) != 1 || len(report.BadRanges) != 1 || len(report.Duplicates) != 1 {
+		t.Errorf("problems = %d malformed, %d bad ranges, %d duplicates, want 1 each",
+			len(report.Malformed), len(report.BadRanges), len(report.Duplicates))
+	}
+}
+
+func TestMergeKeepsFirstEntry(t *testing.T) {
+	first := mustLoadIOCs(t, `[{"name": "x", "version": "1.0.0", "reason": "first"}]`)
+	second := mustLoadIOCs(t, `[{"name": "x", "version": "1.0.0", "reason": "second"}, {"name": "y", "version": "*"}]`)
+	first.Merge(second)
+	if ioc := first.Lookup("x", "1.0.0"); ioc == nil || ioc.Reason != "first" {
+		t.Errorf("merged x = %+v, want the first entry", ioc)
+	}
+	if first.Lookup("y", "1.0.0") == nil {
+		t.Error("y from the second set not merged")
+	}
+}
+
+func TestNormalizeName(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"lodash", "lodash"},
+		{" lodash ", "lodash"},
+		{"JSONStream", "JSONStream"},
+		{"@scope/name", "@scope/name"},
+		{"@Scope/Name", "@scope/name"},
+		{"scope/name", "@scope/name"},
+		{"npm:@scope/name", "@scope/name"},
+		{"npm:lodash", "lodash"},
+		{"https://registry.npmjs.org/lodash", "lodash"},
+		{"https://registry.npmjs.org/@Scope/Name", "@scope/name"},
+		{"registry.npmjs.org/@scope/name/", "@scope/name"},
+		{"localhost:4873/pkg", "pkg"},
+	}
+	for _, tt := range tests {
+		if got := normalizeName(tt.in); got != tt.want {
+			t.Errorf("normalizeName(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestLookupNormalizesNames(t *testing.T) {
+	iocs := mustLoadIOCs(t, "@Scope/Name,1.0.0\nscope/other,2.0.0\nLegacy,3.0.0\n")
+	tests := []struct {
+		name, version string
+		want          bool
+	}{
+		{"@scope/name", "1.0.0", true},
+		{"@Scope/Name", "1.0.0", true},
+		{"@scope/other", "2.0.0", true},
+		{"Legacy", "3.0.0", true},
+		// Unscoped names keep their case unless -ignore-name-case is set
+		{"legacy", "3.0.0", false},
+	}
+	for _, tt := range tests {
+		if got := iocs.Lookup(tt.name, tt.version) != nil; got != tt.want {
+			t.Errorf("Lookup(%q, %q) matched = %v, want %v", tt.name, tt.version, got, tt.want)
+		}
+	}
+
+	iocs.IgnoreNameCase()
+	if iocs.Lookup("legacy", "3.0.0") == nil {
+		t.Error("legacy@3.0.0 not matched with IgnoreNameCase")
+	}
+}
+
+func TestLookupVersionSpelling(t *testing.T) {
+	iocs := mustLoadIOCs(t, "a,v1.0.0\nb,1.0.0\nc,1.0.0+abc\nd,=1.2.3\ne,v=1.2.3\n")
+	tests := []struct {
+		name, version           string
+		want, wantIgnoringBuild bool
+	}{
+		{"a", "1.0.0", true, true},
+		{"a", "v1.0.0", true, true},
+		{"b", "v1.0.0", true, true},
+		{"b", "1.0.0+abc", false, true},
+		{"c", "1.0.0+abc", true, true},
+		{"c", "1.0.0", false, true},
+		{"c", "1.0.0+def", false, true},
+		{"b", "1.0.0-abc", false, false},
+		{"b", "=1.0.0", true, true},
+		{"d", "1.2.3", true, true},
+		{"d", "v1.2.3", true, true},
+		{"e", "1.2.3", true, true},
+		{"e", "=1.2.3", true, true},
+	}
+	for _, tt := range tests {
+		if got := iocs.Lookup(tt.name, tt.version) != nil; got != tt.want {
+			t.Errorf("Lookup(%q, %q) matched = %v, want %v", tt.name, tt.version, got, tt.want)
+		}
+	}
+	iocs.IgnoreBuildMetadata()
+	for _, tt := range tests {
+		if got := iocs.Lookup(tt.name, tt.version) != nil; got != tt.wantIgnoringBuild {
+			t.Errorf("ignoring build metadata, Lookup(%q, %q) matched = %v, want %v", tt.name, tt.version, got, tt.wantIgnoringBuild)
+		}
+	}
+}
+
+// BenchmarkLookupHit measures lookups of exact entries, keyed by iocKey,
+// against the formatted "name,version" string keys used before
+func BenchmarkLookupHit(b *testing.B) {
+	iocs := mustLoadIOCs(b, largeIOCText(1000))
+	names := make([]string, 1000)
+	versions := make([]string, len(names))
+	byString := make(map[string]*IOC, len(names))
+	for i := range names {
+		names[i], versions[i] = fmt.Sprintf("pkg-%d", i), fmt.Sprintf("1.0.%d", i%10)
+		byString[names[i]+","+versions[i]] = &IOC{}
+	}
+
+	b.Run("struct-key", func(b *testing.B) {
+		b.ReportAllocs()
+		i := 0
+		for b.Loop() {
+			if iocs.Lookup(names[i%len(names)], versions[i%len(names)]) == nil {
+				b.Fatal("entry not found")
+			}
+			i++
+		}
+	})
+	b.Run("sprintf-key", func(b *testing.B) {
+		b.ReportAllocs()
+		i := 0
+		for b.Loop() {
+			if byString[fmt.Sprintf("%s,%s", names[i%len(names)], versions[i%len(names)])] == nil {
+				b.Fatal("entry not found")
+			}
+			i++
+		}
+	})
+}
+
+func TestNormalizeVersion(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"1.2.3", "1.2.3"},
+		{" v1.2.3 ", "1.2.3"},
+		{"V1.2.3", "1.2.3"},
+		{"=1.2.3", "1.2.3"},
+		{"v=1.2.3", "1.2.3"},
+		{"==v1.2.3", "1.2.3"},
+		{"1.2.3+abc", "1.2.3+abc"},
+		{"v", "v"},
+		{"=", "="},
+		{"vnext", "vnext"},
+	}
+	for _, tt := range tests {
+		if got := normalizeVersion(tt.in, false); got != tt.want {
+			t.Errorf("normalizeVersion(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
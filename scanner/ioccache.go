@@ -0,0 +1,135 @@
+package scanner
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// iocCacheMeta describes a cached copy of a remote IOC feed. It is stored
+// as JSON next to the copy.
+type iocCacheMeta struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"lastModified,omitempty"`
+	Fetched      time.Time `json:"fetched"`
+}
+
+// iocCachePath returns the path of the cached copy of url in dir, named by
+// the SHA-256 of the URL; its metadata has an added ".json" suffix
+func iocCachePath(dir, url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(dir, hex.EncodeToString(sum[:]))
+}
+
+// readIOCCache returns the metadata of the cached copy at path, or nil if
+// there is no complete copy
+func readIOCCache(path string) *iocCacheMeta {
+	data, err := os.ReadFile(path + ".json")
+	if err != nil {
+		return nil
+	}
+	var meta iocCacheMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		debugf("ignoring unreadable IOC cache metadata %s: %v", path+".json", err)
+		return nil
+	}
+	if _, err := os.Stat(path); err != nil {
+		return nil
+	}
+	return &meta
+}
+
+// fetchCachedIOCs returns the IOC feed at url from the cache in
+// opts.CacheDir if it was fetched within opts.CacheTTL. Otherwise it asks
+// the server, which can answer 304 Not Modified for an unchanged feed, and
+// updates the cache. If the server cannot be reached or fails, a stale
+// cached copy is used with a warning.
+func fetchCachedIOCs(url string, opts FetchOptions) (io.ReadCloser, error) {
+	path := iocCachePath(opts.CacheDir, url)
+	cached := readIOCCache(path)
+	if cached != nil && time.Since(cached.Fetched) < opts.CacheTTL {
+		debugf("using cached copy of %s fetched at %s", url, cached.Fetched.Format(time.RFC3339))
+		return openIOCCache(path)
+	}
+
+	fallback := func(err error) (io.ReadCloser, error) {
+		if cached == nil {
+			return nil, err
+		}
+		warnf("%v; using cached copy fetched at %s\n", err, cached.Fetched.Format(time.RFC3339))
+		return openIOCCache(path)
+	}
+
+	resp, err := requestIOCs(url, opts, cached)
+	if err != nil {
+		return fallback(err)
+	}
+	if resp.StatusCode == http.StatusNotModified {
+		resp.Body.Close()
+		cached.Fetched = time.Now()
+		if err := writeIOCCacheMeta(path, cached); err != nil {
+			warnf("could not update IOC cache for %s: %v\n", url, err)
+		}
+		return openIOCCache(path)
+	}
+
+	body, err := decodeIOCResponse(resp)
+	if err != nil {
+		return fallback(err)
+	}
+	defer body.Close()
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return fallback(fmt.Errorf("failed to read IOC response: %w", err))
+	}
+
+	meta := &iocCacheMeta{
+		URL:          url,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Fetched:      time.Now(),
+	}
+	if err := writeIOCCache(path, data, meta); err != nil {
+		warnf("could not cache IOC file %s: %v\n", url, err)
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// openIOCCache opens the cached copy at path
+func openIOCCache(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cached IOC file: %w", err)
+	}
+	return f, nil
+}
+
+// writeIOCCache stores a downloaded feed and its metadata at path. The
+// metadata is written last, so an interrupted write leaves no copy that
+// looks complete.
+func writeIOCCache(path string, data []byte, meta *iocCacheMeta) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	if err := WriteFileAtomic(path, data); err != nil {
+		return err
+	}
+	return writeIOCCacheMeta(path, meta)
+}
+
+// writeIOCCacheMeta stores the metadata of the cached copy at path
+func writeIOCCacheMeta(path string, meta *iocCacheMeta) error {
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(path+".json", data)
+}
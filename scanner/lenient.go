@@ -0,0 +1,70 @@
+package scanner
+
+import (
+	"bytes"
+	"io"
+)
+
+// readLenientPackageJSON reads a package.json that is not strict JSON, but
+// has // or /* */ comments or trailing commas, as some tooling writes them
+func readLenientPackageJSON(path string, maxSize int64) (*PackageJSON, error) {
+	file, err := openFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxSize {
+		return nil, errFileTooLarge
+	}
+	return decodePackageJSON(bytes.NewReader(stripJSONExtensions(data)), path)
+}
+
+// stripJSONExtensions removes comments and the commas trailing the last
+// element of objects and arrays, leaving strings untouched, so the result
+// can be parsed as JSON
+func stripJSONExtensions(data []byte) []byte {
+	out := make([]byte, 0, len(data))
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case c == '"':
+			// Copy the string, including escaped quotes
+			start := i
+			for i++; i < len(data) && data[i] != '"'; i++ {
+				if data[i] == '\\' {
+					i++
+				}
+			}
+			out = append(out, data[start:min(i+1, len(data))]...)
+		case c == '/' && i+1 < len(data) && data[i+1] == '/':
+			for i < len(data) && data[i] != '\n' {
+				i++
+			}
+			if i < len(data) {
+				out = append(out, '\n')
+			}
+		case c == '/' && i+1 < len(data) && data[i+1] == '*':
+			end := bytes.Index(data[i+2:], []byte("*/"))
+			if end < 0 {
+				return out
+			}
+			i += end + 3
+			out = append(out, ' ')
+		case c == '}' || c == ']':
+			// Drop a comma before the closing bracket, past any blanks
+			trimmed := bytes.TrimRight(out, " \t\r\n")
+			if len(trimmed) > 0 && trimmed[len(trimmed)-1] == ',' {
+				out = append(trimmed[:len(trimmed)-1], out[len(trimmed):]...)
+			}
+			out = append(out, c)
+		default:
+			out = append(out, c)
+		}
+	}
+	return out
+}
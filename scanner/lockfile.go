@@ -0,0 +1,405 @@
+package scanner
+
+import (
+	"bufio"
+	"encoding/json"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// lockedPackage is a name/version pair resolved in a lockfile
+type lockedPackage struct {
+	Name      string
+	Version   string
+	Integrity string   // tarball hash, if recorded by the lockfile
+	Chain     []string // dependency chain from the project down to the package, if known
+}
+
+// lockfileParsers maps lockfile names to their parsers
+var lockfileParsers = map[string]func(path string) ([]lockedPackage, error){
+	"package-lock.json":   parsePackageLock,
+	"npm-shrinkwrap.json": parsePackageLock, // same format, published inside packages
+	"yarn.lock":           parseYarnLock,
+	"pnpm-lock.yaml":      parsePnpmLock,
+	".pnp.data.json":      parsePnpData,   // Yarn Plug'n'Play, no node_modules
+	".pnp.cjs":            parsePnpLoader, // Yarn Plug'n'Play with inlined state
+	"bun.lock":            parseBunLock,
+	"bun.lockb":           parseBunLockb, // binary, only reported as unparseable
+}
+
+// packageLock represents the parts of package-lock.json we need.
+// lockfileVersion 2/3 use the flat "packages" map keyed by install path,
+// while version 1 only has the nested "dependencies" tree.
+type packageLock struct {
+	LockfileVersion int                          `json:"lockfileVersion"`
+	Packages        map[string]packageLockEntry  `json:"packages"`
+	Dependencies    map[string]packageLockV1Node `json:"dependencies"`
+}
+
+type packageLockEntry struct {
+	Name      string `json:"name"`
+	Version   string `json:"version"`
+	Integrity string `json:"integrity"`
+	Link      bool   `json:"link"`
+}
+
+type packageLockV1Node struct {
+	Version      string                       `json:"version"`
+	Integrity    string                       `json:"integrity"`
+	Dependencies map[string]packageLockV1Node `json:"dependencies"`
+}
+
+// parsePackageLock extracts all resolved packages from a package-lock.json
+// or npm-shrinkwrap.json file
+func parsePackageLock(path string) ([]lockedPackage, error) {
+	lock, err := readPackageLock(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var pkgs []lockedPackage
+
+	// v2 files carry both sections; the packages map is authoritative
+	if len(lock.Packages) > 0 {
+		for key, entry := range lock.Packages {
+			// Skip the root project and links to workspace/local directories
+			if key == "" || entry.Link {
+				continue
+			}
+			name := entry.Name
+			if name == "" {
+				name = packageNameFromInstallPath(key)
+			}
+			if name != "" && entry.Version != "" {
+				pkgs = append(pkgs, lockedPackage{
+					Name:      name,
+					Version:   entry.Version,
+					Integrity: entry.Integrity,
+					Chain:     installChain(key),
+				})
+			}
+		}
+		return pkgs, nil
+	}
+
+	var walk func(deps map[string]packageLockV1Node, parents []string)
+	walk = func(deps map[string]packageLockV1Node, parents []string) {
+		for name, dep := range deps {
+			chain := append(parents[:len(parents):len(parents)], name)
+			// Aliased dependencies are keyed by the alias, with the real
+			// package in the version ("npm:evil@1.0.0")
+			realName, version := name, dep.Version
+			if alias, v, ok := npmAlias(version); ok {
+				realName, version = alias, v
+			}
+			if version != "" {
+				pkgs = append(pkgs, lockedPackage{Name: realName, Version: version, Integrity: dep.Integrity, Chain: chain})
+			}
+			walk(dep.Dependencies, chain)
+		}
+	}
+	walk(lock.Dependencies, nil)
+
+	return pkgs, nil
+}
+
+// readPackageLock reads a package-lock.json style file
+func readPackageLock(path string) (*packageLock, error) {
+	data, err := readFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var lock packageLock
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return nil, err
+	}
+	return &lock, nil
+}
+
+// hiddenLockfiles caches the integrity hashes recorded in
+// node_modules/.package-lock.json files (npm 7+), keyed by lockfile path.
+// It is safe for concurrent use by the scan workers.
+type hiddenLockfiles struct {
+	mu    sync.Mutex
+	cache map[string]map[string]string // lockfile path -> install path -> integrity
+}
+
+func newHiddenLockfiles() *hiddenLockfiles {
+	return &hiddenLockfiles{cache: make(map[string]map[string]string)}
+}
+
+// lookup returns the integrity recorded for an installed package directory,
+// or "" if there is no hidden lockfile or no entry for it
+func (h *hiddenLockfiles) lookup(packageDir string) string {
+	// The hidden lockfile lives in the first node_modules of the project,
+	// and its keys are install paths relative to the project directory
+	slashDir := filepath.ToSlash(packageDir)
+	idx := strings.Index(slashDir, "/node_modules/")
+	if idx < 0 {
+		return ""
+	}
+	projectDir := filepath.FromSlash(slashDir[:idx])
+	lockPath := filepath.Join(projectDir, "node_modules", ".package-lock.json")
+	key := slashDir[idx+1:]
+
+	h.mu.Lock()
+	hashes, ok := h.cache[lockPath]
+	if !ok {
+		hashes = loadHiddenLockfile(lockPath)
+		h.cache[lockPath] = hashes
+	}
+	h.mu.Unlock()
+
+	return hashes[key]
+}
+
+// loadHiddenLockfile reads the install path -> integrity map of a hidden lockfile
+func loadHiddenLockfile(path string) map[string]string {
+	lock, err := readPackageLock(path)
+	if err != nil {
+		return nil
+	}
+	hashes := make(map[string]string, len(lock.Packages))
+	for key, entry := range lock.Packages {
+		if entry.Integrity != "" {
+			hashes[key] = entry.Integrity
+		}
+	}
+	return hashes
+}
+
+// packageNameFromInstallPath derives the package name from a lockfile key like
+// "node_modules/a/node_modules/@scope/b" (yielding "@scope/b")
+func packageNameFromInstallPath(key string) string {
+	idx := strings.LastIndex(key, "node_modules/")
+	if idx < 0 {
+		return ""
+	}
+	return key[idx+len("node_modules/"):]
+}
+
+// installChain derives the dependency chain from the nested node_modules
+// segments of an install path, e.g. "node_modules/a/node_modules/@scope/b"
+// yields [a @scope/b]. Tool directories such as .pnpm or .bin are skipped.
+func installChain(path string) []string {
+	var chain []string
+	parts := strings.Split(filepath.ToSlash(path), "/")
+	for i := 0; i < len(parts)-1; i++ {
+		if parts[i] != "node_modules" {
+			continue
+		}
+		name := parts[i+1]
+		if strings.HasPrefix(name, "@") && i+2 < len(parts) {
+			name += "/" + parts[i+2]
+		}
+		if name != "" && !strings.HasPrefix(name, ".") {
+			chain = append(chain, name)
+		}
+	}
+	return chain
+}
+
+// joinChain appends a lockfile entry's chain to the chain of the package
+// containing the lockfile. An entry without a chain stays without one.
+func joinChain(parents, chain []string) []string {
+	if len(parents) == 0 || len(chain) == 0 {
+		return chain
+	}
+	return append(parents[:len(parents):len(parents)], chain...)
+}
+
+// parseYarnLock extracts all resolved packages from a yarn.lock file. Blocks
+// start with an unindented header listing one or more "name@range" specs
+// (e.g. `"@babel/core@^7.0.0", "@babel/core@^7.1.0":`) followed by an
+// indented `version "x.y.z"` line (or `version: x.y.z` in Yarn 2+).
+func parseYarnLock(path string) ([]lockedPackage, error) {
+	file, err := openFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var pkgs []lockedPackage
+	var names []string
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		// Unindented lines start a new block
+		if line[0] != ' ' && line[0] != '\t' {
+			names = yarnHeaderNames(strings.TrimSuffix(trimmed, ":"))
+			continue
+		}
+
+		if len(names) == 0 {
+			continue
+		}
+		version, ok := yarnVersionLine(trimmed)
+		if !ok {
+			continue
+		}
+		for _, name := range names {
+			pkgs = append(pkgs, lockedPackage{Name: name, Version: version})
+		}
+		names = nil
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return pkgs, nil
+}
+
+// yarnHeaderNames returns the distinct package names of a yarn.lock block
+// header. Aliases ("foo@npm:evil@^1.0.0") yield the real package name.
+func yarnHeaderNames(header string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, spec := range strings.Split(header, ",") {
+		spec = strings.Trim(strings.TrimSpace(spec), `"`)
+		name := packageNameFromSpec(spec)
+		if at := strings.Index(spec, "@npm:"); at > 0 {
+			if alias, _, ok := npmAlias(spec[at+1:]); ok {
+				name = alias
+			}
+		}
+		if name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// packageNameFromSpec strips the range from a "name@range" spec, keeping the
+// leading "@" of scoped packages (e.g. "@babel/core@^7.0.0" -> "@babel/core")
+func packageNameFromSpec(spec string) string {
+	idx := strings.LastIndex(spec, "@")
+	if idx <= 0 {
+		return ""
+	}
+	return spec[:idx]
+}
+
+// yarnVersionLine parses `version "1.2.3"` (classic) or `version: 1.2.3` (Berry)
+func yarnVersionLine(line string) (string, bool) {
+	rest, ok := strings.CutPrefix(line, "version")
+	if !ok {
+		return "", false
+	}
+	rest = strings.TrimPrefix(rest, ":")
+	if rest == "" || (rest[0] != ' ' && rest[0] != '\t') {
+		return "", false
+	}
+	version := strings.Trim(strings.TrimSpace(rest), `"`)
+	return version, version != ""
+}
+
+// parsePnpmLock extracts all packages from the "packages:" section of a
+// pnpm-lock.yaml file. Package keys come in two flavours:
+//
+//	lockfileVersion 5.x:  /name/1.0.0, /@scope/name/1.0.0_peer@2.0.0
+//	lockfileVersion 6+:   /name@1.0.0, '@scope/name@1.0.0(peer@2.0.0)'
+//
+// The file is read line by line so no YAML parser is needed.
+func parsePnpmLock(path string) ([]lockedPackage, error) {
+	file, err := openFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var pkgs []lockedPackage
+	legacyKeys := false
+	inPackages := false
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+
+		// Top-level keys switch sections
+		if line[0] != ' ' {
+			if v, ok := strings.CutPrefix(line, "lockfileVersion:"); ok {
+				v = strings.Trim(strings.TrimSpace(v), `'"`)
+				if major, _, _ := strings.Cut(v, "."); major != "" {
+					if n, err := strconv.Atoi(major); err == nil && n < 6 {
+						legacyKeys = true
+					}
+				}
+			}
+			inPackages = line == "packages:"
+			continue
+		}
+
+		// Package keys are indented by exactly two spaces
+		if !inPackages || !strings.HasPrefix(line, "  ") || strings.HasPrefix(line, "   ") || !strings.HasSuffix(line, ":") {
+			continue
+		}
+		key := strings.Trim(strings.TrimSuffix(strings.TrimSpace(line), ":"), `'"`)
+
+		var pkg lockedPackage
+		var ok bool
+		if legacyKeys {
+			pkg, ok = parsePnpmLegacyKey(key)
+		} else {
+			pkg, ok = parsePnpmKey(key)
+		}
+		if ok {
+			pkgs = append(pkgs, pkg)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return pkgs, nil
+}
+
+// parsePnpmKey parses a lockfileVersion 6+ key like "/@scope/name@1.0.0(react@18.2.0)"
+func parsePnpmKey(key string) (lockedPackage, bool) {
+	key = strings.TrimPrefix(key, "/")
+	// Drop peer dependency suffixes
+	if idx := strings.Index(key, "("); idx >= 0 {
+		key = key[:idx]
+	}
+	name := packageNameFromSpec(key)
+	if name == "" {
+		return lockedPackage{}, false
+	}
+	return lockedPackage{Name: name, Version: key[len(name)+1:]}, true
+}
+
+// parsePnpmLegacyKey parses a lockfileVersion 5.x key like
+// "/@scope/name/1.0.0_react@18.2.0", optionally prefixed by a registry host
+func parsePnpmLegacyKey(key string) (lockedPackage, bool) {
+	segments := strings.Split(strings.TrimPrefix(key, "/"), "/")
+	if len(segments) < 2 {
+		return lockedPackage{}, false
+	}
+
+	// Drop peer dependency suffixes
+	version, _, _ := strings.Cut(segments[len(segments)-1], "_")
+	nameSegments := segments[:len(segments)-1]
+
+	name := nameSegments[len(nameSegments)-1]
+	if len(nameSegments) >= 2 && strings.HasPrefix(nameSegments[len(nameSegments)-2], "@") {
+		name = nameSegments[len(nameSegments)-2] + "/" + name
+	}
+	if name == "" || version == "" {
+		return lockedPackage{}, false
+	}
+	return lockedPackage{Name: name, Version: version}, true
+}
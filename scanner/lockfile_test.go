@@ -0,0 +1,173 @@
+package scanner
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// lockedNames returns "name@version" for each package, sorted
+func lockedNames(pkgs []lockedPackage) []string {
+	var names []string
+	for _, pkg := range pkgs {
+		names = append(names, pkg.Name+"@"+pkg.Version)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func TestLockfileParsers(t *testing.T) {
+	tests := []struct {
+		file, content string
+		want          []string
+	}{
+		{
+			file: "package-lock.json",
+			content: `{
+  "lockfileVersion": 3,
+  "packages": {
+    "": {"name": "app", "version": "0.1.0"},
+    "node_modules/a": {"version": "1.0.0"},
+    "node_modules/a/node_modules/@scope/b": {"version": "2.0.0"},
+    "node_modules/local": {"link": true, "resolved": "packages/local"},
+    "node_modules/alias": {"name": "real", "version": "3.0.0"}
+  }
+}`,
+			want: []string{"@scope/b@2.0.0", "a@1.0.0", "real@3.0.0"},
+		},
+		{
+			file: "npm-shrinkwrap.json",
+			content: `{
+  "lockfileVersion": 1,
+  "dependencies": {
+    "a": {"version": "1.0.0", "dependencies": {"b": {"version": "2.0.0"}}},
+    "alias": {"version": "npm:real@3.0.0"}
+  }
+}`,
+			want: []string{"a@1.0.0", "b@2.0.0", "real@3.0.0"},
+		},
+		{
+			file: "yarn.lock",
+			content: `# yarn lockfile v1
+
+"@scope/a@^1.0.0", "@scope/a@^1.1.0":
+  version "1.2.0"
+  resolved "https://registry.yarnpkg.com/@scope/a/-/a-1.2.0.tgz"
+
+b@~2.0.0:
+  version "2.0.3"
+
+alias@npm:real@^3.0.0:
+  version "3.0.1"
+`,
+			want: []string{"@scope/a@1.2.0", "b@2.0.3", "real@3.0.1"},
+		},
+		{
+			file: "yarn.lock",
+			content: `__metadata:
+  version: 6
+
+"c@npm:^4.0.0":
+  version: 4.1.0
+  resolution: "c@npm:4.1.0"
+`,
+			want: []string{"c@4.1.0"},
+		},
+		{
+			file: "pnpm-lock.yaml",
+			content: `lockfileVersion: '6.0'
+
+packages:
+
+  /a@1.0.0:
+    resolution: {integrity: sha512-x}
+
+  /@scope/b@2.0.0(react@18.2.0):
+    resolution: {integrity: sha512-y}
+`,
+			want: []string{"@scope/b@2.0.0", "a@1.0.0"},
+		},
+		{
+			file: "pnpm-lock.yaml",
+			content: `lockfileVersion: 5.4
+
+packages:
+
+  /a/1.0.0:
+    resolution: {integrity: sha512-x}
+
+  /@scope/b/2.0.0_react@18.2.0:
+    resolution: {integrity: sha512-y}
+`,
+			want: []string{"@scope/b@2.0.0", "a@1.0.0"},
+		},
+		{
+			file: "bun.lock",
+			content: `{
+  // bun.lock is JSONC
+  "lockfileVersion": 1,
+  "packages": {
+    "a": ["a@1.0.0", "", {}, "sha512-x"],
+    "a/b": ["b@2.0.0", "", {}, "sha512-y"],
+    "ws": ["ws@workspace:packages/ws"],
+  },
+}`,
+			want: []string{"a@1.0.0", "b@2.0.0"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			path := writeFile(t, t.TempDir(), tt.file, tt.content)
+			pkgs, err := lockfileParsers[tt.file](path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := lockedNames(pkgs); !slices.Equal(got, tt.want) {
+				t.Errorf("packages = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPackageLockChainAndIntegrity(t *testing.T) {
+	path := writeFile(t, t.TempDir(), "package-lock.json", `{
+  "lockfileVersion": 2,
+  "packages": {
+    "node_modules/a/node_modules/b": {"version": "2.0.0", "integrity": "sha512-abc"}
+  }
+}`)
+	pkgs, err := parsePackageLock(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pkgs) != 1 {
+		t.Fatalf("got %d packages, want 1", len(pkgs))
+	}
+	if got := strings.Join(pkgs[0].Chain, " > "); got != "a > b" {
+		t.Errorf("chain = %q, want %q", got, "a > b")
+	}
+	if pkgs[0].Integrity != "sha512-abc" {
+		t.Errorf("integrity = %q, want sha512-abc", pkgs[0].Integrity)
+	}
+}
+
+func TestBinaryBunLockb(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, dir, "bun.lockb", "\x00binary")
+	if _, err := parseBunLockb(path); err != errBinaryLockfile {
+		t.Errorf("err = %v, want errBinaryLockfile", err)
+	}
+
+	// With a text bun.lock next to it, that one is checked instead
+	writeFile(t, dir, "bun.lock", `{"packages": {}}`)
+	if pkgs, err := parseBunLockb(path); err != nil || pkgs != nil {
+		t.Errorf("got %v, %v, want nothing", pkgs, err)
+	}
+}
+
+func TestBrokenLockfile(t *testing.T) {
+	path := writeFile(t, t.TempDir(), "package-lock.json", `{"packages": `)
+	if _, err := parsePackageLock(path); err == nil {
+		t.Error("truncated package-lock.json parsed without error")
+	}
+}
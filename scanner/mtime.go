@@ -0,0 +1,123 @@
+package scanner
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// installMarkers are files package managers write into node_modules at the
+// end of an install; their modification time is taken as the install time
+var installMarkers = []string{
+	".package-lock.json", // npm 7+ hidden lockfile
+	".modules.yaml",      // pnpm
+	".yarn-state.yml",    // Yarn Berry with the node_modules linker
+	".yarn-integrity",    // Yarn Classic
+}
+
+// mtimeTolerance allows for coarse file system timestamps and files written
+// while the install finishes
+const mtimeTolerance = time.Minute
+
+// installTime returns the time the packages below dir were installed: the
+// modification time of the install marker in the nearest node_modules
+// directory above it that has one. The result is cached per directory.
+func (c *fileChecker) installTime(dir string) (time.Time, bool) {
+	for d := dir; ; d = filepath.Dir(d) {
+		if filepath.Base(d) == "node_modules" {
+			if t, ok := c.installTimes.Load(d); ok {
+				if t := t.(time.Time); !t.IsZero() {
+					return t, true
+				}
+			} else {
+				var found time.Time
+				for _, marker := range installMarkers {
+					if info, err := os.Stat(filepath.Join(d, marker)); err == nil {
+						found = info.ModTime()
+						break
+					}
+				}
+				c.installTimes.Store(d, found)
+				if !found.IsZero() {
+					return found, true
+				}
+			}
+		}
+		if parent := filepath.Dir(d); parent == d {
+			return time.Time{}, false
+		}
+	}
+}
+
+// newestFile returns the most recently modified file of a package,
+// without descending into its own node_modules
+func newestFile(packageDir string) (string, time.Time) {
+	var newest string
+	var newestTime time.Time
+	filepath.WalkDir(packageDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if path != packageDir && d.Name() == "node_modules" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info, err := d.Info(); err == nil && info.ModTime().After(newestTime) {
+			newest, newestTime = path, info.ModTime()
+		}
+		return nil
+	})
+	return newest, newestTime
+}
+
+// checkModified reports the newest file of an installed package if it was
+// modified after the reference time (Options.ModifiedAfter, or else the
+// install time), which npm and other package managers never do themselves
+func (c *fileChecker) checkModified(packageDir string) (string, time.Time, bool) {
+	reference := c.modifiedAfter
+	if reference.IsZero() {
+		t, ok := c.installTime(packageDir)
+		if !ok {
+			return "", time.Time{}, false
+		}
+		reference = t.Add(mtimeTolerance)
+	}
+	file, modified := newestFile(packageDir)
+	if file == "" || !modified.After(reference) {
+		return "", time.Time{}, false
+	}
+	return file, modified, true
+}
+
+// modTime returns when the package or file of a match was last modified:
+// for installed packages the later of the package directory (which
+// changes when the package is installed, as package managers keep the
+// tarball's file times) and its package.json, else the file the match was
+// found in. It is zero if neither can be read.
+func modTime(m Match) time.Time {
+	var latest time.Time
+	paths := []string{m.File()}
+	if m.Source == SourceInstalled {
+		paths = append(paths, m.Path)
+	}
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest
+}
+
+// filterNewer keeps the matches modified after t
+func filterNewer(matches []Match, t time.Time) []Match {
+	kept := matches[:0]
+	for _, m := range matches {
+		if modTime(m).After(t) {
+			kept = append(kept, m)
+		}
+	}
+	return kept
+}
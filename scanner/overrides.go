@@ -0,0 +1,78 @@
+package scanner
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Override is a version forced for a (possibly transitive) dependency
+type Override struct {
+	Name    string
+	Version string
+}
+
+// Overrides holds the versions a project forces for its dependencies, from
+// npm's "overrides", Yarn's "resolutions" or pnpm's "pnpm.overrides".
+// Selector keys such as "a>foo", "**/foo" or "foo@<2" name the package
+// forced (foo), and nested npm overrides ({"a": {".": "1.0.0", "foo":
+// "2.0.0"}}) are flattened.
+type Overrides []Override
+
+// UnmarshalJSON flattens nested override objects. Values that are not
+// versions, such as npm's "$foo" references and pnpm's "-" removals, are
+// dropped, and malformed ones are ignored rather than failing the whole
+// package.json.
+func (o *Overrides) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err == nil {
+		*o = appendOverrides(nil, "", raw)
+	}
+	return nil
+}
+
+// appendOverrides appends the overrides of an object nested below the
+// package parent ("" at the top level)
+func appendOverrides(list Overrides, parent string, raw map[string]json.RawMessage) Overrides {
+	for key, value := range raw {
+		name := parent
+		if key != "." {
+			name = overrideTarget(key)
+		}
+		if name == "" {
+			continue
+		}
+		var version string
+		if err := json.Unmarshal(value, &version); err == nil {
+			if version != "" && version != "-" && !strings.HasPrefix(version, "$") {
+				list = append(list, Override{Name: name, Version: version})
+			}
+			continue
+		}
+		var nested map[string]json.RawMessage
+		if err := json.Unmarshal(value, &nested); err == nil {
+			list = appendOverrides(list, name, nested)
+		}
+	}
+	return list
+}
+
+// overrideTarget returns the name of the package an override selector
+// forces: the last package of a pnpm chain ("a>foo") or Yarn path
+// ("a/**/foo"), without a version selector ("foo@<2")
+func overrideTarget(key string) string {
+	if idx := strings.LastIndex(key, ">"); idx >= 0 {
+		key = key[idx+1:]
+	}
+	segments := strings.Split(strings.Trim(key, "/"), "/")
+	name := segments[len(segments)-1]
+	if len(segments) > 1 && strings.HasPrefix(segments[len(segments)-2], "@") {
+		name = segments[len(segments)-2] + "/" + name
+	}
+	if at := strings.LastIndex(name, "@"); at > 0 {
+		name = name[:at]
+	}
+	if name == "**" || name == "*" {
+		return ""
+	}
+	return name
+}
@@ -0,0 +1,540 @@
+package scanner
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// expandEnvVars expands environment variables in a path
+// Supports both %VAR% (Windows) and $VAR or ${VAR} (Unix) syntax
+func expandEnvVars(path string) string {
+	// First expand Unix-style variables using os.ExpandEnv
+	result := os.ExpandEnv(path)
+
+	// Then expand Windows-style %VAR% variables
+	re := regexp.MustCompile(`%([^%]+)%`)
+	result = re.ReplaceAllStringFunc(result, func(match string) string {
+		varName := strings.Trim(match, "%")
+		if val := os.Getenv(varName); val != "" {
+			return val
+		}
+		return match // Keep original if not found
+	})
+
+	return result
+}
+
+// expandTilde expands a leading "~" (current user) or "~user" to the home
+// directory. A "~" anywhere but at the start of the first segment is kept.
+func expandTilde(path string) string {
+	if !strings.HasPrefix(path, "~") {
+		return path
+	}
+	name, rest := path[1:], ""
+	if i := strings.IndexAny(name, `/\`); i >= 0 {
+		name, rest = name[:i], name[i:]
+	}
+
+	var home string
+	if name == "" {
+		dir, err := os.UserHomeDir()
+		if err != nil {
+			return path
+		}
+		home = dir
+	} else {
+		u, err := user.Lookup(name)
+		if err != nil {
+			return path
+		}
+		home = u.HomeDir
+	}
+	return home + rest
+}
+
+// ExpandGlobPath expands "~", environment variables, brace alternations
+// ("{a,b}") and glob patterns in a path and returns all matching paths
+func ExpandGlobPath(path string) []string {
+	return ExpandGlobPathIn(path, "")
+}
+
+// ExpandGlobPathIn is like ExpandGlobPath, but resolves a relative path
+// against baseDir instead of the working directory (if baseDir is set)
+func ExpandGlobPathIn(path, baseDir string) []string {
+	// First expand the home directory and environment variables
+	expandedPath := resolveAgainst(baseDir, expandEnvVars(expandTilde(path)))
+
+	var paths []string
+	seen := make(map[string]bool)
+	for _, pattern := range expandBraces(expandedPath) {
+		for _, p := range expandGlob(pattern) {
+			if !seen[p] {
+				seen[p] = true
+				paths = append(paths, p)
+			}
+		}
+	}
+	return paths
+}
+
+// resolveAgainst joins a relative path to baseDir. Absolute paths, and on
+// Windows paths with a drive or a leading separator, are returned as is.
+func resolveAgainst(baseDir, path string) string {
+	if baseDir == "" || path == "" || filepath.IsAbs(path) || filepath.VolumeName(path) != "" || os.IsPathSeparator(path[0]) {
+		return path
+	}
+	return filepath.Join(baseDir, path)
+}
+
+// expandGlob expands the glob patterns in a single path
+func expandGlob(path string) []string {
+	// Clean the path (normalize separators)
+	expandedPath := filepath.Clean(path)
+
+	// Check if path contains glob patterns
+	if !strings.Contains(expandedPath, "*") && !strings.Contains(expandedPath, "?") {
+		return []string{unescapeBraces(expandedPath)}
+	}
+
+	// Use filepath.Glob to expand
+	matches, err := filepath.Glob(expandedPath)
+	if err != nil || len(matches) == 0 {
+		// Return original path if glob fails or no matches
+		return []string{expandedPath}
+	}
+
+	return matches
+}
+
+// braceEscapes reports whether a backslash escapes the next character in
+// patterns; on Windows it is the path separator instead
+func braceEscapes() bool {
+	return runtime.GOOS != "windows"
+}
+
+// expandBraces expands shell-style alternations, so "a/{b,c{1,2}}/d" yields
+// a/b/d, a/c1/d and a/c2/d. Groups without a comma and unbalanced braces are
+// kept literally, as are braces and commas escaped with a backslash.
+func expandBraces(pattern string) []string {
+	lbrace, rbrace, commas := findBraceGroup(pattern)
+	if lbrace < 0 {
+		return []string{pattern}
+	}
+
+	prefix, suffix := pattern[:lbrace], pattern[rbrace+1:]
+	var results []string
+	start := lbrace + 1
+	for _, comma := range append(commas, rbrace) {
+		alternative := pattern[start:comma]
+		results = append(results, expandBraces(prefix+alternative+suffix)...)
+		start = comma + 1
+	}
+	return results
+}
+
+// findBraceGroup returns the positions of the first expandable brace group
+// and of its top-level commas, or lbrace = -1 if there is none
+func findBraceGroup(pattern string) (lbrace, rbrace int, commas []int) {
+	escapes := braceEscapes()
+	for i := 0; i < len(pattern); i++ {
+		if escapes && pattern[i] == '\\' {
+			i++
+			continue
+		}
+		if pattern[i] != '{' {
+			continue
+		}
+
+		// Find the matching close brace, noting commas at this level
+		depth := 0
+		commas = commas[:0]
+		for j := i + 1; j < len(pattern); j++ {
+			switch c := pattern[j]; {
+			case escapes && c == '\\':
+				j++
+			case c == '{':
+				depth++
+			case c == '}' && depth > 0:
+				depth--
+			case c == '}':
+				if len(commas) > 0 {
+					return i, j, commas
+				}
+				j = len(pattern) // "{x}" is literal, look for the next group
+			case c == ',' && depth == 0:
+				commas = append(commas, j)
+			}
+		}
+	}
+	return -1, -1, nil
+}
+
+// unescapeBraces removes the backslashes escaping braces and commas in a
+// path that is not passed on to filepath.Glob (which handles them itself)
+func unescapeBraces(path string) string {
+	if !braceEscapes() || !strings.Contains(path, "\\") {
+		return path
+	}
+	r := strings.NewReplacer(`\{`, "{", `\}`, "}", `\,`, ",")
+	return r.Replace(path)
+}
+
+// isPathForCurrentOS checks if a path is intended for the current OS
+func isPathForCurrentOS(path string) bool {
+	isWindows := runtime.GOOS == "windows"
+
+	// Check for definitive OS-specific patterns
+	// Leading "/" is a definitive Unix absolute path indicator
+	isDefinitelyUnix := strings.HasPrefix(path, "/")
+
+	// Drive letter (e.g., "C:") and UNC shares (e.g., "\\server\share", also
+	// in the "\\?\" extended-length form) are definitive Windows path indicators
+	isDefinitelyWindows := (len(path) >= 2 && path[1] == ':') || strings.HasPrefix(path, `\\`)
+
+	// Definitive indicators take priority - reject paths clearly meant for other OS
+	if isWindows {
+		// On Windows, reject paths that definitively start with Unix root
+		if isDefinitelyUnix {
+			return false
+		}
+		// Accept Windows paths or ambiguous paths (relative, env vars only, etc.)
+		return true
+	}
+
+	// On Unix, reject paths that have Windows drive letters
+	if isDefinitelyWindows {
+		return false
+	}
+	// Accept Unix paths or ambiguous paths
+	return true
+}
+
+// longPath returns the extended-length form of a path on Windows
+// ("\\?\C:\..." or "\\?\UNC\server\share\..."), which lifts the
+// 260 character MAX_PATH limit that deep node_modules trees easily exceed.
+// Elsewhere, and for paths already in that form, it returns path unchanged.
+func longPath(path string) string {
+	if runtime.GOOS != "windows" || strings.HasPrefix(path, `\\?\`) {
+		return path
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	if strings.HasPrefix(abs, `\\`) {
+		return `\\?\UNC\` + abs[2:]
+	}
+	return `\\?\` + abs
+}
+
+// LoadPathsFromFile reads scan paths from a file, or from stdin if pathsFile is "-"
+func LoadPathsFromFile(pathsFile string) ([]string, error) {
+	return LoadPathsFromFileIn(pathsFile, "")
+}
+
+// LoadPathsFromFileIn is like LoadPathsFromFile, but resolves relative
+// paths against baseDir instead of the working directory (if baseDir is set)
+func LoadPathsFromFileIn(pathsFile, baseDir string) ([]string, error) {
+	if pathsFile == "-" {
+		return ReadPathsIn(os.Stdin, baseDir)
+	}
+
+	file, err := os.Open(pathsFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open paths file: %w", err)
+	}
+	defer file.Close()
+
+	return ReadPathsIn(file, baseDir)
+}
+
+// ReadPaths reads newline-delimited scan paths, skipping comments and paths
+// meant for another OS, and expanding env vars and globs
+func ReadPaths(r io.Reader) ([]string, error) {
+	return ReadPathsIn(r, "")
+}
+
+// ReadPathsIn is like ReadPaths, but resolves relative paths against
+// baseDir instead of the working directory (if baseDir is set)
+func ReadPathsIn(r io.Reader, baseDir string) ([]string, error) {
+	var paths []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		// Skip empty lines and comments
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// Skip paths not intended for current OS
+		if !isPathForCurrentOS(line) {
+			continue
+		}
+
+		// Expand glob patterns (which also expands env vars)
+		expandedPaths := ExpandGlobPathIn(line, baseDir)
+		paths = append(paths, expandedPaths...)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read paths file: %w", err)
+	}
+
+	return paths, nil
+}
+
+// DefaultPaths returns fallback paths if no paths file is found: the
+// NODE_PATH directories, the global node_modules of the npm prefix, common
+// Homebrew locations and the Node versions of nvm, fnm and volta
+func DefaultPaths() []string {
+	var dirs []string
+	for _, dir := range filepath.SplitList(os.Getenv("NODE_PATH")) {
+		if dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+	if dir := npmGlobalModules(); dir != "" {
+		dirs = append(dirs, dir)
+	}
+
+	dirs = append(dirs,
+		"/usr/local/lib/node_modules",
+		"/opt/homebrew/lib/node_modules",
+	)
+
+	// Add Homebrew Intel Cellar paths using glob expansion
+	cellarPaths, err := filepath.Glob("/usr/local/Cellar/node/*/lib/node_modules")
+	if err == nil {
+		dirs = append(dirs, cellarPaths...)
+	}
+
+	// Add the global modules of every Node version installed by a version manager
+	for _, pattern := range versionManagerPatterns() {
+		if matches, err := filepath.Glob(pattern); err == nil {
+			dirs = append(dirs, matches...)
+		}
+	}
+
+	return dirs
+}
+
+// versionManagerPatterns returns glob patterns for the global node_modules
+// of Node versions installed by nvm, fnm and volta
+func versionManagerPatterns() []string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+
+	if runtime.GOOS == "windows" {
+		appData := os.Getenv("APPDATA")
+		if appData == "" {
+			appData = filepath.Join(home, "AppData", "Roaming")
+		}
+		localAppData := os.Getenv("LOCALAPPDATA")
+		if localAppData == "" {
+			localAppData = filepath.Join(home, "AppData", "Local")
+		}
+		nvmHome := os.Getenv("NVM_HOME")
+		if nvmHome == "" {
+			nvmHome = filepath.Join(appData, "nvm")
+		}
+		return []string{
+			filepath.Join(nvmHome, "*", "node_modules"),
+			filepath.Join(appData, "fnm", "node-versions", "*", "installation", "node_modules"),
+			filepath.Join(localAppData, "Volta", "tools", "image", "node", "*", "node_modules"),
+		}
+	}
+
+	nvmDir := os.Getenv("NVM_DIR")
+	if nvmDir == "" {
+		nvmDir = filepath.Join(home, ".nvm")
+	}
+	fnmDirs := []string{
+		os.Getenv("FNM_DIR"),
+		filepath.Join(home, ".fnm"),
+		filepath.Join(home, ".local", "share", "fnm"),
+		filepath.Join(home, "Library", "Application Support", "fnm"),
+	}
+
+	patterns := []string{
+		filepath.Join(nvmDir, "versions", "node", "*", "lib", "node_modules"),
+		filepath.Join(home, ".volta", "tools", "image", "node", "*", "lib", "node_modules"),
+	}
+	for _, dir := range fnmDirs {
+		if dir != "" {
+			patterns = append(patterns, filepath.Join(dir, "node-versions", "*", "installation", "lib", "node_modules"))
+		}
+	}
+	return patterns
+}
+
+// npmGlobalModules returns the global node_modules directory of the npm on
+// the PATH (from "npm config get prefix"), or "" if npm is not available
+func npmGlobalModules() string {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, "npm", "config", "get", "prefix").Output()
+	if err != nil {
+		return ""
+	}
+	prefix := strings.TrimSpace(string(out))
+	if prefix == "" {
+		return ""
+	}
+
+	// Windows installs global packages directly below the prefix
+	if runtime.GOOS == "windows" {
+		return filepath.Join(prefix, "node_modules")
+	}
+	return filepath.Join(prefix, "lib", "node_modules")
+}
+
+// DropNestedRoots removes scan roots that the walk of another root of the
+// list already covers, and roots that are the same directory as another
+// one, e.g. reached through a symlink or a bind mount. Roots are compared by
+// their absolute, symlink-resolved path (case-insensitively on Windows) and
+// by file identity (os.SameFile). Of several roots that are the same
+// directory, one that is walked (not a symlink, unless symlinks are
+// followed) is kept.
+//
+// A nested root is only dropped if walking the outer root under the walk
+// settings in opts (Exclude, MaxDepth, ScanHidden and FollowSymlinks)
+// covers it. If an excluded or skipped hidden directory lies on the way,
+// the outer root is a symlink that is not followed or a depth limit is set,
+// both roots are kept; ScanContext then reports what both reach only once.
+func DropNestedRoots(roots []string, opts Options) []string {
+	infos := make([]scanRoot, len(roots))
+	for i, root := range roots {
+		infos[i] = newScanRoot(root, opts.FollowSymlinks)
+	}
+
+	// Decide on outer roots first, so that a root is only dropped in favor
+	// of one that is kept; walked roots win over their unwalked twins
+	order := make([]int, len(roots))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		ra, rb := infos[order[a]], infos[order[b]]
+		if len(ra.key) != len(rb.key) {
+			return len(ra.key) < len(rb.key)
+		}
+		return ra.walked && !rb.walked
+	})
+
+	keep := make([]bool, len(roots))
+	var kept []int
+	for _, i := range order {
+		covered := false
+		for _, j := range kept {
+			if infos[i].sameDir(infos[j]) || infos[j].reaches(infos[i].key, opts) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			keep[i] = true
+			kept = append(kept, i)
+		}
+	}
+
+	var result []string
+	for i, root := range roots {
+		if keep[i] {
+			result = append(result, root)
+		}
+	}
+	return result
+}
+
+// scanRoot describes a scan root for DropNestedRoots
+type scanRoot struct {
+	path   string      // absolute path the root is walked (and reported) as
+	key    string      // absolute, symlink-resolved path, see rootKey
+	info   os.FileInfo // nil if the root cannot be accessed
+	walked bool        // whether walking the root descends into it
+}
+
+func newScanRoot(root string, followSymlinks bool) scanRoot {
+	r := scanRoot{path: AbsPath(root), key: rootKey(root)}
+	r.info, _ = os.Stat(root)
+	// filepath.Walk does not descend into a root that is a symlink
+	link, err := os.Lstat(root)
+	r.walked = r.info != nil && r.info.IsDir() && err == nil && (link.Mode()&os.ModeSymlink == 0 || followSymlinks)
+	return r
+}
+
+// sameDir reports whether two roots are the same directory
+func (r scanRoot) sameDir(other scanRoot) bool {
+	return r.key == other.key || r.info != nil && other.info != nil && os.SameFile(r.info, other.info)
+}
+
+// reaches reports whether walking r under opts covers the whole walk of
+// the directory with the given key. Like the walk itself, it applies the
+// exclude patterns and hidden directory skipping to every directory on the
+// way, but not to r. With a depth limit, the walk of r always stops short
+// of the levels a nested root reaches itself.
+func (r scanRoot) reaches(key string, opts Options) bool {
+	if !r.walked || opts.MaxDepth > 0 || !isWithin(r.key, key) {
+		return false
+	}
+	rel, err := filepath.Rel(r.key, key)
+	if err != nil {
+		return false
+	}
+	// The resolved key has no symlinks left, so the walk reaches it through
+	// the same directories below r
+	p := r.path
+	for _, name := range strings.Split(rel, string(filepath.Separator)) {
+		p = filepath.Join(p, name)
+		if isExcluded(p, opts.Exclude) || isCacacheSkipped(p) || !opts.ScanHidden && isSkippedHidden(name) {
+			return false
+		}
+	}
+	return true
+}
+
+// AbsPath returns the absolute, cleaned form of path, or the cleaned path
+// if the working directory cannot be determined
+func AbsPath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return filepath.Clean(path)
+	}
+	return abs
+}
+
+// rootKey normalizes a root for containment checks
+func rootKey(root string) string {
+	key := AbsPath(root)
+	if resolved, err := filepath.EvalSymlinks(key); err == nil {
+		key = resolved
+	}
+	if runtime.GOOS == "windows" {
+		key = strings.ToLower(key)
+	}
+	return key
+}
+
+// isWithin reports whether path is strictly below dir
+func isWithin(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || rel == "." || filepath.IsAbs(rel) {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
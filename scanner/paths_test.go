@@ -0,0 +1,220 @@
+package scanner
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"testing"
+)
+
+// rootTree creates real/node_modules/q, home/.nvm/lib/node_modules/q and
+// the symlink link -> real below a temporary directory and returns that
+// directory
+func rootTree(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	writeFile(t, dir, "real/node_modules/q/package.json", `{"name": "q", "version": "1.0.0"}`)
+	writeFile(t, dir, "home/.nvm/lib/node_modules/q/package.json", `{"name": "q", "version": "1.0.0"}`)
+	if err := os.Symlink(filepath.Join(dir, "real"), filepath.Join(dir, "link")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	return dir
+}
+
+func TestDropNestedRoots(t *testing.T) {
+	dir := rootTree(t)
+	tests := []struct {
+		name  string
+		roots []string
+		opts  Options
+		want  []string
+	}{
+		{
+			name:  "nested root covered",
+			roots: []string{"real/node_modules", "real"},
+			want:  []string{"real"},
+		},
+		{
+			name:  "outer root is a symlink",
+			roots: []string{"link", "real/node_modules"},
+			want:  []string{"link", "real/node_modules"},
+		},
+		{
+			name:  "followed symlink covers",
+			roots: []string{"link", "real/node_modules"},
+			opts:  Options{FollowSymlinks: true},
+			want:  []string{"link"},
+		},
+		{
+			name:  "excluded directory in between",
+			roots: []string{".", "real/node_modules"},
+			opts:  Options{Exclude: []string{"node_modules"}},
+			want:  []string{".", "real/node_modules"},
+		},
+		{
+			name:  "depth limit",
+			roots: []string{"real", "real/node_modules"},
+			opts:  Options{MaxDepth: 1},
+			want:  []string{"real", "real/node_modules"},
+		},
+		{
+			name:  "hidden directory in between",
+			roots: []string{".", "home/.nvm/lib/node_modules"},
+			want:  []string{".", "home/.nvm/lib/node_modules"},
+		},
+		{
+			name:  "hidden directory scanned",
+			roots: []string{".", "home/.nvm/lib/node_modules"},
+			opts:  Options{ScanHidden: true},
+			want:  []string{"."},
+		},
+		{
+			name:  "symlink before its target",
+			roots: []string{"link", "real"},
+			want:  []string{"real"},
+		},
+		{
+			name:  "symlink after its target",
+			roots: []string{"real", "link"},
+			want:  []string{"real"},
+		},
+		{
+			name:  "followed symlink and its target",
+			roots: []string{"link", "real"},
+			opts:  Options{FollowSymlinks: true},
+			want:  []string{"link"},
+		},
+		{
+			name:  "same root twice",
+			roots: []string{"real", "real/"},
+			want:  []string{"real"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var roots []string
+			for _, root := range tt.roots {
+				roots = append(roots, filepath.Join(dir, root))
+			}
+			var got []string
+			for _, root := range DropNestedRoots(roots, tt.opts) {
+				rel, _ := filepath.Rel(dir, root)
+				got = append(got, filepath.ToSlash(rel))
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("kept %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScanOverlappingRootsReportsOnce(t *testing.T) {
+	dir := rootTree(t)
+	roots := []string{filepath.Join(dir, "real"), filepath.Join(dir, "real", "node_modules")}
+	opts := Options{Exclude: []string{"nothing"}, MaxDepth: 3}
+	result, err := Scan(Options{
+		Roots:    DropNestedRoots(roots, opts),
+		IOCs:     mustLoadIOCs(t, "q,1.0.0\n"),
+		Exclude:  opts.Exclude,
+		MaxDepth: opts.MaxDepth,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Scanned) != 2 {
+		t.Errorf("scanned %v, want both roots", result.Scanned)
+	}
+	if got := matchNames(result.Matches); !slices.Equal(got, []string{"q@1.0.0"}) {
+		t.Errorf("matches = %v, want q@1.0.0 once", got)
+	}
+}
+
+func TestScanRootBelowHiddenDirectory(t *testing.T) {
+	dir := rootTree(t)
+	home := filepath.Join(dir, "home")
+	roots := []string{home, filepath.Join(home, ".nvm", "lib", "node_modules")}
+	result, err := Scan(Options{Roots: DropNestedRoots(roots, Options{}), IOCs: mustLoadIOCs(t, "q,1.0.0\n")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := matchNames(result.Matches); !slices.Equal(got, []string{"q@1.0.0"}) {
+		t.Errorf("matches = %v, want q@1.0.0 from the listed root", got)
+	}
+
+	// A hidden directory given as the root itself is scanned
+	result, err = Scan(Options{Roots: []string{filepath.Join(home, ".nvm")}, IOCs: mustLoadIOCs(t, "q,1.0.0\n")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Matches) != 1 {
+		t.Errorf("matches = %v below a hidden root, want q@1.0.0", matchNames(result.Matches))
+	}
+}
+
+func TestExpandBraces(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{"a/b", []string{"a/b"}},
+		{"a/{b,c}/d", []string{"a/b/d", "a/c/d"}},
+		{"a/{b,c{1,2}}/d", []string{"a/b/d", "a/c1/d", "a/c2/d"}},
+		{"{a,b}/{c,d}", []string{"a/c", "a/d", "b/c", "b/d"}},
+		{"a/{,x}b", []string{"a/b", "a/xb"}},
+		{"a/{b}/c", []string{"a/{b}/c"}},
+		{"a/{b}/{c,d}", []string{"a/{b}/c", "a/{b}/d"}},
+		{"a/{b,c", []string{"a/{b,c"}},
+		{"a/b,c}", []string{"a/b,c}"}},
+		{"~/{.nvm,.volta}/*/node_modules", []string{"~/.nvm/*/node_modules", "~/.volta/*/node_modules"}},
+	}
+	for _, tt := range tests {
+		if got := expandBraces(tt.pattern); !slices.Equal(got, tt.want) {
+			t.Errorf("expandBraces(%q) = %q, want %q", tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestExpandBracesEscapes(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("backslash is the path separator on Windows")
+	}
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{`a/\{b,c\}`, []string{`a/\{b,c\}`}},
+		{`a/{b\,c,d}`, []string{`a/b\,c`, "a/d"}},
+		{`a/{b\},c}`, []string{`a/b\}`, "a/c"}},
+	}
+	for _, tt := range tests {
+		if got := expandBraces(tt.pattern); !slices.Equal(got, tt.want) {
+			t.Errorf("expandBraces(%q) = %q, want %q", tt.pattern, got, tt.want)
+		}
+	}
+	if got := unescapeBraces(`a/\{b\,c\}`); got != "a/{b,c}" {
+		t.Errorf("unescapeBraces = %q, want a/{b,c}", got)
+	}
+}
+
+func TestExpandGlobPathBraces(t *testing.T) {
+	dir := t.TempDir()
+	for _, p := range []string{"one/x1", "one/x2", "two/x3", "three/x4"} {
+		if err := os.MkdirAll(filepath.Join(dir, p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var got []string
+	for _, p := range ExpandGlobPathIn("{one,two}/x*", dir) {
+		rel, _ := filepath.Rel(dir, p)
+		got = append(got, filepath.ToSlash(rel))
+	}
+	if want := []string{"one/x1", "one/x2", "two/x3"}; !slices.Equal(got, want) {
+		t.Errorf("expanded to %v, want %v", got, want)
+	}
+
+	// Alternatives that expand to the same path are listed once
+	if got := ExpandGlobPathIn("{one,one}", dir); len(got) != 1 {
+		t.Errorf("expanded to %v, want one path", got)
+	}
+}
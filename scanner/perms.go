@@ -0,0 +1,43 @@
+package scanner
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// Writable is a node_modules directory or installed package.json that
+// users other than its owner may write to, found if Options.CheckPerms is
+// set. Any local process running as such a user could tamper with the
+// packages.
+type Writable struct {
+	Path string `json:"path"`
+	Root string `json:"root"`
+	Mode string `json:"mode"` // permission bits as listed by ls, e.g. "drwxrwxrwx"
+}
+
+// isLooselyWritable reports whether path is a node_modules directory or a
+// package.json below one with the group or other write bit set. Symlinks
+// are skipped, as their own mode grants nothing, and so is Windows, whose
+// ACLs the mode bits do not reflect.
+func isLooselyWritable(path string, info os.FileInfo) bool {
+	if runtime.GOOS == "windows" || info.Mode()&os.ModeSymlink != 0 || info.Mode().Perm()&0o022 == 0 {
+		return false
+	}
+	if info.IsDir() {
+		return info.Name() == "node_modules"
+	}
+	return info.Name() == "package.json" && strings.Contains(filepath.Dir(path), "node_modules")
+}
+
+// sortWritable orders findings by root and path
+func sortWritable(list []Writable) {
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Root != list[j].Root {
+			return list[i].Root < list[j].Root
+		}
+		return list[i].Path < list[j].Path
+	})
+}
@@ -0,0 +1,133 @@
+package scanner
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// pnpState represents the parts of the Yarn Plug'n'Play runtime state we
+// need. packageRegistryData is a list of [name, [[reference, info], ...]]
+// pairs, where the reference of a registry package is "npm:1.2.3" (or
+// "virtual:<hash>#npm:1.2.3" for packages with peer dependencies).
+type pnpState struct {
+	PackageRegistryData []json.RawMessage `json:"packageRegistryData"`
+}
+
+// pnpStateMarker starts the JSON string literal holding the runtime state
+// in a .pnp.cjs file (unless Yarn writes it to .pnp.data.json instead)
+const pnpStateMarker = "RAW_RUNTIME_STATE ="
+
+// parsePnpData extracts the registry packages from a Yarn Berry
+// .pnp.data.json file
+func parsePnpData(path string) ([]lockedPackage, error) {
+	data, err := readFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parsePnpState(data)
+}
+
+// parsePnpLoader extracts the registry packages from the state inlined in a
+// Yarn Berry .pnp.cjs loader. A loader without inlined state (its state is
+// in .pnp.data.json next to it) yields no packages.
+func parsePnpLoader(path string) ([]lockedPackage, error) {
+	data, err := readFile(path)
+	if err != nil {
+		return nil, err
+	}
+	idx := bytes.Index(data, []byte(pnpStateMarker))
+	if idx < 0 {
+		return nil, nil
+	}
+	state, ok := unquoteJSString(strings.TrimLeft(string(data[idx+len(pnpStateMarker):]), " \t\r\n"))
+	if !ok {
+		return nil, errors.New("malformed RAW_RUNTIME_STATE literal")
+	}
+	return parsePnpState([]byte(state))
+}
+
+// unquoteJSString decodes the single-quoted JavaScript string literal at
+// the start of s, as written by Yarn (escaped backslashes, quotes and line
+// continuations)
+func unquoteJSString(s string) (string, bool) {
+	if !strings.HasPrefix(s, "'") {
+		return "", false
+	}
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\'':
+			return b.String(), true
+		case '\\':
+			i++
+			if i == len(s) {
+				return "", false
+			}
+			if s[i] != '\n' {
+				b.WriteByte(s[i])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", false
+}
+
+// parsePnpState extracts the registry packages from the runtime state JSON.
+// Workspaces, links and other non-registry references are skipped.
+func parsePnpState(data []byte) ([]lockedPackage, error) {
+	var state pnpState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+
+	var pkgs []lockedPackage
+	for _, raw := range state.PackageRegistryData {
+		var entry []json.RawMessage
+		if err := json.Unmarshal(raw, &entry); err != nil || len(entry) != 2 {
+			continue
+		}
+		// The top-level project has a null name
+		var name *string
+		if err := json.Unmarshal(entry[0], &name); err != nil || name == nil {
+			continue
+		}
+		var references [][]json.RawMessage
+		if err := json.Unmarshal(entry[1], &references); err != nil {
+			continue
+		}
+		for _, ref := range references {
+			if len(ref) == 0 {
+				continue
+			}
+			var reference string
+			if err := json.Unmarshal(ref[0], &reference); err != nil {
+				continue
+			}
+			if realName, version, ok := pnpVersion(reference); ok {
+				if realName == "" {
+					realName = *name
+				}
+				pkgs = append(pkgs, lockedPackage{Name: realName, Version: version})
+			}
+		}
+	}
+	return pkgs, nil
+}
+
+// pnpVersion returns the version of an npm reference such as "npm:1.2.3"
+// or "virtual:<hash>#npm:1.2.3", and for aliases ("npm:name@1.2.3") also
+// the real package name, which is "" otherwise
+func pnpVersion(reference string) (name, version string, ok bool) {
+	idx := strings.LastIndex(reference, "npm:")
+	if idx < 0 {
+		return "", "", false
+	}
+	version = reference[idx+len("npm:"):]
+	if at := strings.LastIndex(version, "@"); at > 0 {
+		name, version = version[:at], version[at+1:]
+	}
+	return name, version, version != ""
+}
@@ -0,0 +1,1158 @@
+// Package scanner checks installed npm packages and lockfiles against a
+// list of IOCs (compromised package names and versions).
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Warnings receives warnings about malformed input such as invalid IOC
+// lines if Logger is not set. It defaults to stderr and can be set to
+// io.Discard.
+var Warnings io.Writer = os.Stderr
+
+// Logger, if set, receives warnings instead of Warnings, as well as debug
+// messages about each directory entered and package.json parsed
+var Logger *slog.Logger
+
+// warnf logs a warning to Logger, or writes it to Warnings
+func warnf(format string, args ...any) {
+	if Logger != nil {
+		Logger.Warn(strings.TrimSpace(fmt.Sprintf(format, args...)))
+		return
+	}
+	fmt.Fprintf(Warnings, "Warning: "+format, args...)
+}
+
+// debugf logs a debug message to Logger, if set
+func debugf(format string, args ...any) {
+	if Logger != nil && Logger.Enabled(context.Background(), slog.LevelDebug) {
+		Logger.Debug(fmt.Sprintf(format, args...))
+	}
+}
+
+// PackageJSON represents the minimal structure we need from package.json
+type PackageJSON struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Dist    struct {
+		Integrity string `json:"integrity"`
+		// Attestations is set by the registry for packages published with
+		// provenance (npm publish --provenance)
+		Attestations *struct {
+			URL        string `json:"url"`
+			Provenance *struct {
+				PredicateType string `json:"predicateType"`
+			} `json:"provenance"`
+		} `json:"attestations"`
+	} `json:"dist"`
+	LegacyIntegrity string `json:"_integrity"` // written by npm <= 6 on install
+
+	Scripts map[string]string `json:"scripts"`
+
+	// Read for the suspicion score only
+	Main        string            `json:"main"`
+	Repository  json.RawMessage   `json:"repository"` // string or object
+	Maintainers []json.RawMessage `json:"maintainers"`
+
+	Dependencies     map[string]string `json:"dependencies"`
+	DevDependencies  map[string]string `json:"devDependencies"`
+	PeerDependencies map[string]string `json:"peerDependencies"`
+
+	// Versions forced for transitive dependencies
+	Overrides   Overrides `json:"overrides"`   // npm
+	Resolutions Overrides `json:"resolutions"` // Yarn
+	Pnpm        struct {
+		Overrides Overrides `json:"overrides"`
+	} `json:"pnpm"`
+
+	Workspaces Workspaces `json:"workspaces"`
+}
+
+// integrity returns the tarball integrity recorded in the package.json, if any
+func (p *PackageJSON) integrity() string {
+	if p.Dist.Integrity != "" {
+		return p.Dist.Integrity
+	}
+	return p.LegacyIntegrity
+}
+
+// hasProvenance reports whether the package.json references a provenance
+// attestation. Only the reference is checked, not the attestation itself.
+func (p *PackageJSON) hasProvenance() bool {
+	a := p.Dist.Attestations
+	return a != nil && a.Provenance != nil && a.Provenance.PredicateType != ""
+}
+
+// Match sources
+const (
+	SourceInstalled = "installed" // package.json of an installed package
+	SourceLockfile  = "lockfile"  // entry resolved in a lockfile
+	SourceDeclared  = "declared"  // dependency range declared in a project's package.json
+	SourceOverride  = "override"  // version forced in a project's package.json (overrides, resolutions)
+	SourceTarball   = "tarball"   // package.json inside a package tarball, whose path is the tarball
+	SourceCache     = "cache"     // tarball recorded in an npm cache index, whose path is the index bucket
+	SourceContent   = "content"   // content rule found in a source file of an installed package, whose path is the file
+)
+
+// Match represents a package found during scanning
+type Match struct {
+	Name       string `json:"name"`
+	Version    string `json:"version"`
+	Path       string `json:"path"` // package (or project) directory, or the lockfile for lockfile matches
+	Root       string `json:"root"` // scan root the match was found under
+	Source     string `json:"source"`
+	IOCMatched bool   `json:"iocMatched"`
+	Severity   string `json:"severity,omitempty"`
+	Reason     string `json:"reason,omitempty"`
+	Integrity  string `json:"integrity,omitempty"` // set when matched by tarball hash
+	Baselined  bool   `json:"baselined,omitempty"` // listed in the baseline, informational only
+
+	// MatchedRule is the IOC entry that matched ("name,version", where the
+	// version may be a range, "*" or a hash), and RuleLocation where it was
+	// loaded from (e.g. "line 3 of ioc.txt")
+	MatchedRule  string `json:"matchedRule,omitempty"`
+	RuleLocation string `json:"ruleLocation,omitempty"`
+	Line         int    `json:"line,omitempty"` // line of a content rule hit in the file at Path
+
+	// InstallScripts lists the lifecycle scripts run on install
+	// ("postinstall: node setup.js"), if Options.FlagInstallScripts is set
+	InstallScripts []string `json:"installScripts,omitempty"`
+
+	// NoProvenance is set for installed packages whose package.json
+	// references no provenance attestation, if Options.CheckProvenance is set
+	NoProvenance bool `json:"noProvenance,omitempty"`
+
+	// Score is the suspicion score of an installed package and ScoreReasons
+	// the signals adding up to it, if Options.Score is set and the score
+	// reaches Options.ScoreThreshold
+	Score        int      `json:"score,omitempty"`
+	ScoreReasons []string `json:"scoreReasons,omitempty"`
+
+	// ModifiedFile is the newest file of an installed package modified
+	// after it was installed, at ModifiedAt, if Options.MtimeCheck is set
+	ModifiedFile string    `json:"modifiedFile,omitempty"`
+	ModifiedAt   time.Time `json:"modifiedAt,omitzero"`
+
+	// Chain is the dependency chain that pulled the package in, from the
+	// top-level dependency down to the package itself (e.g. [a b foo])
+	Chain []string `json:"chain,omitempty"`
+
+	// Paths lists every location of the package when matches were
+	// collapsed by DedupeMatches; Path is then the first of them
+	Paths []string `json:"paths,omitempty"`
+}
+
+// newMatch creates an IOC match carrying the entry's metadata
+func newMatch(name, version, path, source string, ioc *IOC) Match {
+	return Match{
+		Name:         name,
+		Version:      version,
+		Path:         path,
+		Source:       source,
+		IOCMatched:   true,
+		Severity:     ioc.Severity,
+		Reason:       ioc.Reason,
+		MatchedRule:  ioc.Rule(),
+		RuleLocation: ioc.where,
+	}
+}
+
+// File returns the file the match was found in
+func (m Match) File() string {
+	switch m.Source {
+	case SourceLockfile, SourceTarball, SourceCache, SourceContent:
+		return m.Path
+	}
+	return filepath.Join(m.Path, "package.json")
+}
+
+// Options configures a scan
+type Options struct {
+	Roots    []string // directories to scan; match paths are reported absolute
+	IOCs     *IOCSet
+	Workers  int      // concurrent package.json parsers; defaults to runtime.NumCPU()
+	Exclude  []string // glob patterns (base name or full path, "**" allowed) of subtrees to skip
+	MaxDepth int      // directory levels below each root to descend into; <= 0 means unlimited
+
+	// Include restricts the scan to packages whose name matches one of
+	// these glob patterns (e.g. "@scope/*"); others are skipped entirely.
+	// Empty means all packages.
+	Include []string
+
+	// Inventory records every parsed installed package in Result.Inventory
+	Inventory bool
+
+	// Allowlist holds entries verified to be safe; IOC matches it lists are
+	// dropped (or kept as plain inventory entries in inventory mode)
+	Allowlist *IOCSet
+
+	// FlagInstallScripts reports installed packages defining preinstall,
+	// install or postinstall scripts in Result.Suspicious
+	FlagInstallScripts bool
+
+	// CheckProvenance reports installed packages whose package.json
+	// references no provenance attestation in Result.Unattested. This is a
+	// weak signal: npm does not copy the registry's dist metadata into
+	// installed packages, and many legitimate packages have no provenance.
+	CheckProvenance bool
+
+	// Score computes a heuristic suspicion score for each installed package
+	// (install scripts, obfuscation, recent modification, missing
+	// repository, single maintainer) and lists those scoring at least
+	// ScoreThreshold in Result.Scored, highest first
+	Score          bool
+	ScoreThreshold int // <= 0 means DefaultScoreThreshold
+
+	// CheckPerms lists node_modules directories and installed package.json
+	// files that are group or other writable in Result.Writable (not on
+	// Windows)
+	CheckPerms bool
+
+	// MtimeCheck lists installed packages with a file modified after
+	// ModifiedAfter in Result.Modified, e.g. by post-install tampering. With
+	// ModifiedAfter zero, the install time is used instead: the
+	// modification time of the marker file npm, pnpm or Yarn writes into
+	// node_modules (packages without one are not checked).
+	MtimeCheck    bool
+	ModifiedAfter time.Time
+
+	// NewerThan, if set, drops every result (matches, inventory entries and
+	// the other lists) whose package or file was not modified after it,
+	// e.g. to focus on recent installs during an incident
+	NewerThan time.Time
+
+	// CheckDeps also checks the dependency ranges declared in project
+	// package.json files (outside node_modules) against the IOCs, reporting
+	// those that allow a listed version with SourceDeclared, and the
+	// versions they force via overrides or resolutions with SourceOverride
+	CheckDeps bool
+
+	// LenientJSON retries package.json files that fail to parse as strict
+	// JSON with comments and trailing commas removed
+	LenientJSON bool
+
+	// MaxFileSize skips package.json files larger than this many bytes;
+	// <= 0 means DefaultMaxFileSize
+	MaxFileSize int64
+
+	// MaxOpenFiles bounds how many package.json files and lockfiles are open
+	// at the same time, for systems with a low open file limit; <= 0 means
+	// DefaultMaxOpenFiles
+	MaxOpenFiles int
+
+	// FollowSymlinks descends into symlinked directories (e.g. from npm link
+	// or pnpm), guarding against symlink loops
+	FollowSymlinks bool
+
+	// ScanTarballs also checks the package.json inside .tgz and .tar.gz
+	// package tarballs, such as those in offline mirrors, reporting matches
+	// with SourceTarball
+	ScanTarballs bool
+
+	// ContentRules are searched for in the .js, .cjs and .mjs files of all
+	// installed packages, reporting each rule found in a file as a match
+	// with SourceContent; source files above MaxFileSize and binary files
+	// are skipped
+	ContentRules []ContentRule
+
+	// ScanHidden also descends into hidden directories (see isSkippedHidden),
+	// which are skipped by default
+	ScanHidden bool
+
+	// Logf receives informational progress messages; nil discards them
+	Logf func(format string, args ...any)
+
+	// OnMatch is called as soon as a match is found, before the scan
+	// completes. Calls are serialized, so it needs no locking of its own.
+	OnMatch func(Match)
+
+	// OnRootDone is called after a root was completely scanned (not when
+	// the scan is cancelled while walking it), with the IOC matches found
+	// below it, e.g. to checkpoint the progress of a long scan
+	OnRootDone func(root string, matches []Match)
+
+	// OnChecked is called after each package.json or lockfile is checked,
+	// e.g. to track progress against CountFiles. It is called concurrently
+	// from the workers.
+	OnChecked func()
+}
+
+// Result holds the outcome of a scan
+type Result struct {
+	Matches   []Match  // sorted IOC matches across all roots
+	Inventory []Match  // all installed packages and IOC matches, if Options.Inventory is set
+	Scanned   []string // roots that were walked
+	Skipped   []string // roots that do not exist
+	Stats     Stats
+
+	// Suspicious lists installed packages with install scripts, if
+	// Options.FlagInstallScripts is set, whether they match an IOC or not
+	Suspicious []Match
+
+	// Unattested lists installed packages without provenance, if
+	// Options.CheckProvenance is set, whether they match an IOC or not
+	Unattested []Match
+
+	// Scored lists installed packages reaching the score threshold, if
+	// Options.Score is set, highest score first
+	Scored []Match
+
+	// Modified lists installed packages with files modified after install,
+	// if Options.MtimeCheck is set
+	Modified []Match
+
+	// Writable lists node_modules directories and package.json files
+	// writable by group or others, if Options.CheckPerms is set
+	Writable []Writable
+}
+
+// Stats summarizes what a scan covered
+type Stats struct {
+	Roots        int           `json:"roots"`        // roots walked
+	PackageFiles int           `json:"packageFiles"` // package.json files read
+	Packages     int           `json:"packages"`     // package.json files parsed successfully
+	Lockfiles    int           `json:"lockfiles"`    // lockfiles parsed successfully
+	ParseErrors  int           `json:"parseErrors"`  // package.json files and lockfiles that could not be read or parsed
+	WalkErrors   int           `json:"walkErrors"`   // files and directories that could not be accessed while walking
+	CacheEntries int           `json:"cacheEntries"` // package tarballs recorded in npm cache indexes
+	ContentFiles int           `json:"contentFiles"` // source files searched for content rules
+	Elapsed      time.Duration `json:"-"`
+}
+
+// scanCounters accumulates Stats concurrently from the workers
+type scanCounters struct {
+	packageFiles, packages, lockfiles, parseErrors, walkErrors, cacheEntries, contentFiles atomic.Int64
+}
+
+// Scan walks all roots in opts and returns the IOC matches found
+func Scan(opts Options) (Result, error) {
+	return ScanContext(context.Background(), opts)
+}
+
+// ScanContext is like Scan but stops walking when ctx is done. In that case
+// the matches found so far are returned together with ctx.Err().
+func ScanContext(ctx context.Context, opts Options) (Result, error) {
+	var result Result
+	if opts.IOCs == nil {
+		return result, errors.New("no IOCs given")
+	}
+	start := time.Now()
+	counters := &scanCounters{}
+	if opts.Workers < 1 {
+		opts.Workers = runtime.NumCPU()
+	}
+	logf := opts.Logf
+	if logf == nil {
+		logf = func(string, ...any) {}
+	}
+
+	// Roots that overlap without covering each other (see DropNestedRoots)
+	// can reach the same files; those are only reported for the first root
+	earlier := newReportedSet()
+	if onMatch := opts.OnMatch; onMatch != nil {
+		opts.OnMatch = func(m Match) {
+			if !earlier.has(m) {
+				onMatch(m)
+			}
+		}
+	}
+
+	for _, dir := range opts.Roots {
+		if ctx.Err() != nil {
+			break
+		}
+		// Every path reported below the root is absolute and clean as well
+		dir = AbsPath(dir)
+
+		// Check if directory exists
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			logf("Skipping non-existent directory: %s\n", dir)
+			result.Skipped = append(result.Skipped, dir)
+			continue
+		}
+
+		logf("Scanning: %s\n", dir)
+		matches, writable, err := scanDirectory(ctx, dir, opts, counters)
+		if err != nil && ctx.Err() == nil {
+			warnf("error scanning %s: %v\n", dir, err)
+			counters.walkErrors.Add(1)
+		}
+		result.Scanned = append(result.Scanned, dir)
+		matches, writable = earlier.add(matches, writable)
+		var rootMatches []Match
+		for _, m := range matches {
+			if m.IOCMatched {
+				rootMatches = append(rootMatches, m)
+			}
+			if len(m.InstallScripts) > 0 {
+				result.Suspicious = append(result.Suspicious, m)
+			}
+			if m.NoProvenance {
+				result.Unattested = append(result.Unattested, m)
+			}
+			if m.Score > 0 {
+				result.Scored = append(result.Scored, m)
+			}
+			if m.ModifiedFile != "" {
+				result.Modified = append(result.Modified, m)
+			}
+		}
+		result.Matches = append(result.Matches, rootMatches...)
+		result.Writable = append(result.Writable, writable...)
+		if opts.Inventory {
+			result.Inventory = append(result.Inventory, matches...)
+		}
+		if opts.OnRootDone != nil && ctx.Err() == nil {
+			opts.OnRootDone(dir, rootMatches)
+		}
+	}
+
+	SortMatches(result.Matches)
+	SortMatches(result.Inventory)
+	SortMatches(result.Suspicious)
+	SortMatches(result.Unattested)
+	SortMatches(result.Scored)
+	SortMatches(result.Modified)
+	sortWritable(result.Writable)
+	sort.SliceStable(result.Scored, func(i, j int) bool {
+		return result.Scored[i].Score > result.Scored[j].Score
+	})
+	result.Stats = Stats{
+		Roots:        len(result.Scanned),
+		PackageFiles: int(counters.packageFiles.Load()),
+		Packages:     int(counters.packages.Load()),
+		Lockfiles:    int(counters.lockfiles.Load()),
+		ParseErrors:  int(counters.parseErrors.Load()),
+		WalkErrors:   int(counters.walkErrors.Load()),
+		CacheEntries: int(counters.cacheEntries.Load()),
+		ContentFiles: int(counters.contentFiles.Load()),
+		Elapsed:      time.Since(start),
+	}
+	return result, ctx.Err()
+}
+
+// DefaultMaxFileSize is the default Options.MaxFileSize
+const DefaultMaxFileSize = 5 << 20
+
+// errFileTooLarge is returned for package.json files above the size limit
+var errFileTooLarge = errors.New("file too large")
+
+// fileBuffers holds the buffers readPackageJSON reads files into, so a scan
+// does not allocate a new byte slice per package.json
+var fileBuffers = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+// maxPooledBuffer is the size above which a buffer is not kept for reuse,
+// so one huge file does not pin its memory for the rest of the scan
+const maxPooledBuffer = 64 << 10
+
+// readPackageJSON reads and parses a package.json file. The file is read
+// into a reused buffer, and files larger than maxSize bytes are rejected
+// with errFileTooLarge without reading them fully.
+func readPackageJSON(path string, maxSize int64) (*PackageJSON, error) {
+	file, err := openFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	buf := fileBuffers.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer func() {
+		if buf.Cap() <= maxPooledBuffer {
+			fileBuffers.Put(buf)
+		}
+	}()
+	if _, err := buf.ReadFrom(io.LimitReader(file, maxSize+1)); err != nil {
+		return nil, err
+	}
+	if int64(buf.Len()) > maxSize {
+		return nil, errFileTooLarge
+	}
+
+	// Unmarshal copies the strings it keeps, so the buffer can be reused
+	var pkg PackageJSON
+	if json.Unmarshal(buf.Bytes(), &pkg) == nil {
+		return &pkg, nil
+	}
+	return decodePackageJSON(bytes.NewReader(buf.Bytes()), path)
+}
+
+// utf8BOM is the byte order mark some Windows editors write at the start
+// of a file
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// decodePackageJSON decodes the first JSON value of r, skipping a leading
+// UTF-8 byte order mark and ignoring any data after the value, so such
+// files are still scanned. path names the file in debug logs.
+func decodePackageJSON(r io.Reader, path string) (*PackageJSON, error) {
+	br := bufio.NewReader(r)
+	if prefix, err := br.Peek(len(utf8BOM)); err == nil && bytes.Equal(prefix, utf8BOM) {
+		br.Discard(len(utf8BOM))
+		debugf("skipped byte order mark in %s", path)
+	}
+	dec := json.NewDecoder(br)
+	var pkg PackageJSON
+	if err := dec.Decode(&pkg); err != nil {
+		return nil, err
+	}
+	if rest, _ := io.ReadAll(dec.Buffered()); len(bytes.TrimSpace(rest)) > 0 {
+		debugf("ignored data after the JSON object in %s", path)
+	}
+	return &pkg, nil
+}
+
+// fileChecker holds what the workers need to check discovered files
+type fileChecker struct {
+	iocs        *IOCSet
+	hashes      *hiddenLockfiles
+	inventory   bool     // also report installed packages that match no IOC
+	maxFileSize int64    // package.json size limit in bytes
+	checkDeps   bool     // check declared dependencies of project manifests
+	flagScripts bool     // record install scripts of installed packages
+	provenance  bool     // record installed packages without provenance
+	score       bool     // score installed packages
+	threshold   int      // score at which packages are recorded
+	mtimeCheck  bool     // record installed packages modified after install
+	lenientJSON bool     // retry package.json files that are not strict JSON
+	include     []string // package name patterns to check; empty means all
+	allowlist   *IOCSet
+	counters    *scanCounters
+
+	contentRules    []ContentRule
+	contentPackages sync.Map // package directory -> *PackageJSON (nil if unreadable)
+
+	modifiedAfter time.Time // reference time of the mtime check; zero means install time
+	newerThan     time.Time // drop results not modified after this; zero keeps all
+	installTimes  sync.Map  // node_modules directory -> install time (zero if unknown)
+}
+
+// checkPackage parses a package.json file and returns a match if it is
+// listed in the IOCs, or if it defines install scripts or lacks provenance
+// and these are flagged.
+// In inventory mode every parsed package is returned, with IOCMatched
+// telling them apart.
+func (c *fileChecker) checkPackage(path string) *Match {
+	pkg := c.readPackage(path)
+	if pkg == nil {
+		return nil
+	}
+
+	// Check if package name and version matches any IOC
+	if pkg.Name == "" || pkg.Version == "" || !isIncluded(pkg.Name, c.include) {
+		return nil
+	}
+	packageDir := filepath.Dir(path)
+	match := c.matchPackage(pkg, packageDir)
+	if c.flagScripts {
+		if scripts := installScripts(pkg); len(scripts) > 0 {
+			if match == nil {
+				match = &Match{Name: pkg.Name, Version: pkg.Version, Path: packageDir, Source: SourceInstalled}
+			}
+			match.InstallScripts = scripts
+		}
+	}
+	if c.provenance && !pkg.hasProvenance() {
+		if match == nil {
+			match = &Match{Name: pkg.Name, Version: pkg.Version, Path: packageDir, Source: SourceInstalled}
+		}
+		match.NoProvenance = true
+	}
+	if c.score {
+		if score, reasons := c.scorePackage(pkg, packageDir); score >= c.threshold {
+			if match == nil {
+				match = &Match{Name: pkg.Name, Version: pkg.Version, Path: packageDir, Source: SourceInstalled}
+			}
+			match.Score, match.ScoreReasons = score, reasons
+		}
+	}
+	if c.mtimeCheck {
+		if file, modified, ok := c.checkModified(packageDir); ok {
+			if match == nil {
+				match = &Match{Name: pkg.Name, Version: pkg.Version, Path: packageDir, Source: SourceInstalled}
+			}
+			match.ModifiedFile, match.ModifiedAt = file, modified
+		}
+	}
+	return match
+}
+
+// matchPackage looks up an installed package by name and version, then by
+// tarball hash. In inventory mode every package is returned, with
+// IOCMatched telling them apart.
+func (c *fileChecker) matchPackage(pkg *PackageJSON, packageDir string) *Match {
+	chain := installChain(packageDir)
+	if ioc := c.iocs.Lookup(pkg.Name, pkg.Version); ioc != nil {
+		match := newMatch(pkg.Name, pkg.Version, packageDir, SourceInstalled, ioc)
+		match.Chain = chain
+		return &match
+	}
+
+	// Fall back to the tarball hash to catch republished versions
+	if c.iocs.hasIntegrity() {
+		integrity := pkg.integrity()
+		if integrity == "" {
+			integrity = c.hashes.lookup(packageDir)
+		}
+		if ioc := c.iocs.LookupIntegrity(integrity); ioc != nil {
+			match := newMatch(pkg.Name, pkg.Version, packageDir, SourceInstalled, ioc)
+			match.Integrity = ioc.Version
+			match.Chain = chain
+			return &match
+		}
+	}
+
+	if c.inventory {
+		return &Match{Name: pkg.Name, Version: pkg.Version, Path: packageDir, Source: SourceInstalled, Chain: chain}
+	}
+	return nil
+}
+
+// installScripts returns the lifecycle scripts npm runs when installing
+// the package, as "name: command"
+func installScripts(pkg *PackageJSON) []string {
+	var scripts []string
+	for _, name := range []string{"preinstall", "install", "postinstall"} {
+		if cmd := pkg.Scripts[name]; cmd != "" {
+			scripts = append(scripts, name+": "+cmd)
+		}
+	}
+	return scripts
+}
+
+// readPackage reads a package.json file, counting and logging failures
+func (c *fileChecker) readPackage(path string) *PackageJSON {
+	c.counters.packageFiles.Add(1)
+	pkg, err := readPackageJSON(path, c.maxFileSize)
+	var syntaxErr *json.SyntaxError
+	if err != nil && c.lenientJSON && errors.As(err, &syntaxErr) {
+		if lenient, lenientErr := readLenientPackageJSON(path, c.maxFileSize); lenientErr == nil {
+			debugf("parsed %s leniently: it is not strict JSON (comments or trailing commas)", path)
+			pkg, err = lenient, nil
+		}
+	}
+	if err != nil {
+		c.counters.parseErrors.Add(1)
+		if err == errFileTooLarge {
+			warnf("skipping %s: larger than %d bytes\n", path, c.maxFileSize)
+		} else if errors.Is(err, fs.ErrPermission) {
+			warnf("cannot read %s: %v\n", path, err)
+		} else {
+			debugf("cannot parse %s: %v", path, err)
+		}
+		return nil
+	}
+	c.counters.packages.Add(1)
+	debugf("parsed %s: %s@%s", path, pkg.Name, pkg.Version)
+	return pkg
+}
+
+// checkManifest parses a project's package.json and returns matches for
+// declared dependencies whose range allows an IOC-listed version, and for
+// IOC-listed versions forced via overrides or resolutions
+func (c *fileChecker) checkManifest(path string) []Match {
+	pkg := c.readPackage(path)
+	if pkg == nil {
+		return nil
+	}
+
+	projectDir := filepath.Dir(path)
+	var matches []Match
+	for _, deps := range []map[string]string{pkg.Dependencies, pkg.DevDependencies, pkg.PeerDependencies} {
+		for name, declared := range deps {
+			// An alias is checked as the package it really installs
+			if alias, rng, ok := npmAlias(declared); ok {
+				name, declared = alias, rng
+			}
+			if !isIncluded(name, c.include) {
+				continue
+			}
+			if ioc := c.iocs.LookupDeclared(name, declared); ioc != nil {
+				matches = append(matches, newMatch(name, declared, projectDir, SourceDeclared, ioc))
+			}
+		}
+	}
+	for _, overrides := range []Overrides{pkg.Overrides, pkg.Resolutions, pkg.Pnpm.Overrides} {
+		for _, o := range overrides {
+			name, forced := o.Name, o.Version
+			if alias, rng, ok := npmAlias(forced); ok {
+				name, forced = alias, rng
+			}
+			if !isIncluded(name, c.include) {
+				continue
+			}
+			if ioc := c.iocs.LookupDeclared(name, forced); ioc != nil {
+				matches = append(matches, newMatch(name, forced, projectDir, SourceOverride, ioc))
+			}
+		}
+	}
+	return matches
+}
+
+// checkLockfile parses a lockfile and returns matches for all IOC-listed entries
+func (c *fileChecker) checkLockfile(path string, parse func(string) ([]lockedPackage, error)) []Match {
+	pkgs, err := parse(path)
+	if err != nil {
+		c.parseFailed(path, err)
+		return nil
+	}
+	debugf("parsed lockfile %s: %d entries", path, len(pkgs))
+	c.counters.lockfiles.Add(1)
+
+	// Lockfiles shipped inside installed packages (npm-shrinkwrap.json)
+	// resolve below that package, so its own chain comes first
+	return c.matchLocked(path, SourceLockfile, installChain(filepath.Dir(path)), pkgs)
+}
+
+// checkCacheIndex parses an npm cache index bucket and returns matches for
+// all IOC-listed tarballs it records
+func (c *fileChecker) checkCacheIndex(path string) []Match {
+	pkgs, err := parseCacacheIndex(path)
+	if err != nil {
+		c.parseFailed(path, err)
+		return nil
+	}
+	debugf("parsed cache index %s: %d entries", path, len(pkgs))
+	c.counters.cacheEntries.Add(int64(len(pkgs)))
+	return c.matchLocked(path, SourceCache, nil, pkgs)
+}
+
+// parseFailed counts a lockfile or cache index that could not be parsed,
+// warning only if it could not be read (or is a binary bun.lockb)
+func (c *fileChecker) parseFailed(path string, err error) {
+	c.counters.parseErrors.Add(1)
+	if errors.Is(err, fs.ErrPermission) || errors.Is(err, errBinaryLockfile) {
+		warnf("cannot read %s: %v\n", path, err)
+	} else {
+		debugf("cannot parse %s: %v", path, err)
+	}
+}
+
+// matchLocked returns matches for the IOC-listed packages resolved in the
+// file at path, by name and version or by integrity, with their chains
+// below parents
+func (c *fileChecker) matchLocked(path, source string, parents []string, pkgs []lockedPackage) []Match {
+	// The same package may be resolved at several places in the tree; the
+	// first chain found is reported
+	type lockKey struct{ name, version, integrity string }
+	var matches []Match
+	seen := make(map[lockKey]bool)
+	for _, pkg := range pkgs {
+		key := lockKey{pkg.Name, pkg.Version, pkg.Integrity}
+		if seen[key] || !isIncluded(pkg.Name, c.include) {
+			continue
+		}
+		seen[key] = true
+		if ioc := c.iocs.Lookup(pkg.Name, pkg.Version); ioc != nil {
+			match := newMatch(pkg.Name, pkg.Version, path, source, ioc)
+			match.Chain = joinChain(parents, pkg.Chain)
+			matches = append(matches, match)
+		} else if ioc := c.iocs.LookupIntegrity(pkg.Integrity); ioc != nil {
+			match := newMatch(pkg.Name, pkg.Version, path, source, ioc)
+			match.Integrity = ioc.Version
+			match.Chain = joinChain(parents, pkg.Chain)
+			matches = append(matches, match)
+		}
+	}
+	return matches
+}
+
+// checkFile dispatches a discovered file to the matching checker and
+// applies the date filter and the allowlist to the result
+func (c *fileChecker) checkFile(path string) []Match {
+	matches := c.dispatch(path)
+	if !c.newerThan.IsZero() && len(matches) > 0 {
+		matches = filterNewer(matches, c.newerThan)
+	}
+	if c.allowlist == nil {
+		return matches
+	}
+
+	kept := matches[:0]
+	for _, m := range matches {
+		if m.IOCMatched && c.allowlist.Lookup(m.Name, m.Version) != nil {
+			debugf("allowlisted %s@%s at %s", m.Name, m.Version, m.Path)
+			if !c.inventory && len(m.InstallScripts) == 0 && !m.NoProvenance && m.Score == 0 && m.ModifiedFile == "" {
+				continue
+			}
+			m = Match{
+				Name:           m.Name,
+				Version:        m.Version,
+				Path:           m.Path,
+				Source:         m.Source,
+				InstallScripts: m.InstallScripts,
+				NoProvenance:   m.NoProvenance,
+				Score:          m.Score,
+				ScoreReasons:   m.ScoreReasons,
+				ModifiedFile:   m.ModifiedFile,
+				ModifiedAt:     m.ModifiedAt,
+				Chain:          m.Chain,
+			}
+		}
+		kept = append(kept, m)
+	}
+	return kept
+}
+
+// dispatch checks a discovered file with the checker for its kind
+func (c *fileChecker) dispatch(path string) []Match {
+	if parse, ok := lockfileParsers[filepath.Base(path)]; ok {
+		return c.checkLockfile(path, parse)
+	}
+	if isCacacheIndex(path) {
+		return c.checkCacheIndex(path)
+	}
+	if isSourceFile(path) {
+		return c.checkContent(path)
+	}
+	if isTarball(path) {
+		if match := c.checkTarball(path); match != nil {
+			return []Match{*match}
+		}
+		return nil
+	}
+	if !strings.Contains(path, "node_modules") {
+		return c.checkManifest(path)
+	}
+	if match := c.checkPackage(path); match != nil {
+		return []Match{*match}
+	}
+	return nil
+}
+
+// ScanDirectory recursively walks a directory and checks for IOC matches,
+// using one worker per CPU
+func ScanDirectory(root string, iocs *IOCSet) ([]Match, error) {
+	matches, _, err := scanDirectory(context.Background(), root, Options{IOCs: iocs, Workers: runtime.NumCPU()}, &scanCounters{})
+	return matches, err
+}
+
+// scanDirectory recursively walks a directory and checks for IOC matches.
+// The walk itself is sequential, while package.json files and lockfiles are
+// read and parsed by a pool of opts.Workers workers. The walk stops early
+// when ctx is cancelled. Statistics are accumulated in counters. With
+// opts.CheckPerms, writable node_modules directories and package.json
+// files are returned as well.
+func scanDirectory(ctx context.Context, dirPath string, opts Options, counters *scanCounters) ([]Match, []Writable, error) {
+	workers := max(opts.Workers, 1)
+
+	var (
+		matches []Match
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+	)
+
+	checker := &fileChecker{
+		iocs:          opts.IOCs,
+		hashes:        newHiddenLockfiles(),
+		inventory:     opts.Inventory,
+		maxFileSize:   opts.MaxFileSize,
+		checkDeps:     opts.CheckDeps,
+		flagScripts:   opts.FlagInstallScripts,
+		provenance:    opts.CheckProvenance,
+		score:         opts.Score,
+		threshold:     opts.ScoreThreshold,
+		mtimeCheck:    opts.MtimeCheck,
+		lenientJSON:   opts.LenientJSON,
+		modifiedAfter: opts.ModifiedAfter,
+		newerThan:     opts.NewerThan,
+		include:       opts.Include,
+		contentRules:  opts.ContentRules,
+		allowlist:     opts.Allowlist,
+		counters:      counters,
+	}
+	if checker.maxFileSize <= 0 {
+		checker.maxFileSize = DefaultMaxFileSize
+	}
+	if checker.threshold <= 0 {
+		checker.threshold = DefaultScoreThreshold
+	}
+	// Each check has at most one file open at a time, so a slot per check
+	// bounds the open files regardless of the number of workers
+	maxOpen := opts.MaxOpenFiles
+	if maxOpen <= 0 {
+		maxOpen = DefaultMaxOpenFiles
+	}
+	openSlots := make(chan struct{}, maxOpen)
+
+	paths := make(chan string, workers*4)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range paths {
+				openSlots <- struct{}{}
+				found := checker.checkFile(path)
+				<-openSlots
+				for i := range found {
+					found[i].Root = dirPath
+				}
+				if opts.OnChecked != nil {
+					opts.OnChecked()
+				}
+				if len(found) > 0 {
+					mu.Lock()
+					matches = append(matches, found...)
+					if opts.OnMatch != nil {
+						for _, m := range found {
+							if m.IOCMatched {
+								opts.OnMatch(m)
+							}
+						}
+					}
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	// Permissions are checked by the walk itself, which has the file info
+	var writable []Writable
+	var onWritable func(string, os.FileInfo)
+	if opts.CheckPerms {
+		onWritable = func(path string, info os.FileInfo) {
+			writable = append(writable, Writable{Path: path, Root: dirPath, Mode: info.Mode().String()})
+		}
+	}
+	err := walkFiles(ctx, dirPath, opts, counters, onWritable, func(path string) {
+		paths <- path
+	})
+
+	close(paths)
+	wg.Wait()
+
+	SortMatches(matches)
+	return matches, writable, err
+}
+
+// walkFiles walks dirPath and calls fn for each package.json, lockfile, npm
+// cache index bucket, (with opts.ScanTarballs) package tarball and (with
+// opts.ContentRules) installed source file to check, skipping excluded and
+// too deep directories. If set, writable is called for each node_modules
+// directory and package.json writable by group or others. Inaccessible
+// paths are logged and counted in counters; with counters nil, nothing is
+// logged, as for the counting pass of CountFiles.
+func walkFiles(ctx context.Context, dirPath string, opts Options, counters *scanCounters, writable func(string, os.FileInfo), fn func(path string)) error {
+	quiet := counters == nil
+	return walkTree(dirPath, opts.FollowSymlinks, func(path string, info os.FileInfo, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if err != nil {
+			// Skip directories that we can't access
+			if !quiet {
+				warnf("cannot access %s: %v\n", path, err)
+				counters.walkErrors.Add(1)
+			}
+			return nil
+		}
+
+		if info.IsDir() {
+			// Prune excluded and hidden subtrees, but never the scan root itself
+			if path != dirPath && isExcluded(path, opts.Exclude) {
+				return filepath.SkipDir
+			}
+			if path != dirPath && !opts.ScanHidden && isSkippedHidden(info.Name()) {
+				return filepath.SkipDir
+			}
+			// The npm cache's content store holds nothing but opaque blobs
+			if isCacacheSkipped(path) {
+				return filepath.SkipDir
+			}
+			if opts.MaxDepth > 0 && depthBelow(dirPath, path) > opts.MaxDepth {
+				return filepath.SkipDir
+			}
+			if !quiet {
+				debugf("entering %s", path)
+			}
+			if writable != nil && isLooselyWritable(path, info) {
+				writable(path, info)
+			}
+			return nil
+		}
+
+		if writable != nil && isLooselyWritable(path, info) {
+			writable(path, info)
+		}
+
+		// Lockfiles are checked wherever they are found
+		if _, ok := lockfileParsers[info.Name()]; ok {
+			fn(path)
+			return nil
+		}
+
+		if isCacacheIndex(path) {
+			fn(path)
+			return nil
+		}
+
+		if len(opts.ContentRules) > 0 && isSourceFile(info.Name()) && strings.Contains(path, "node_modules") {
+			fn(path)
+			return nil
+		}
+
+		if opts.ScanTarballs && isTarball(info.Name()) {
+			fn(path)
+			return nil
+		}
+
+		// Look for package.json files in node_modules
+		if info.Name() != "package.json" {
+			return nil
+		}
+
+		// Check if this is in a node_modules directory, or a project
+		// manifest whose declared dependencies are checked
+		if !strings.Contains(path, "node_modules") && !opts.CheckDeps {
+			return nil
+		}
+
+		fn(path)
+		return nil
+	})
+}
+
+// CountFiles walks all roots in opts like Scan, but only counts the files
+// that would be checked, without opening them. It allows a scan progress
+// to be shown as a percentage.
+func CountFiles(ctx context.Context, opts Options) (int, error) {
+	total := 0
+	for _, dir := range opts.Roots {
+		if _, err := os.Stat(dir); err != nil {
+			continue
+		}
+		err := walkFiles(ctx, dir, opts, nil, nil, func(string) {
+			total++
+		})
+		if ctx.Err() != nil {
+			return total, ctx.Err()
+		}
+		if err != nil {
+			debugf("counting files in %s: %v", dir, err)
+		}
+	}
+	return total, nil
+}
+
+// reportedSet records the matches and writable paths reported for the scan
+// roots done so far
+type reportedSet struct {
+	matches  map[reportedKey]bool
+	writable map[string]bool
+}
+
+// reportedKey identifies a match regardless of the root it was found under
+type reportedKey struct {
+	path, name, version, source, rule, chain string
+	line                                     int
+}
+
+func newReportedSet() *reportedSet {
+	return &reportedSet{matches: make(map[reportedKey]bool), writable: make(map[string]bool)}
+}
+
+func keyOfMatch(m Match) reportedKey {
+	return reportedKey{m.Path, m.Name, m.Version, m.Source, m.MatchedRule, strings.Join(m.Chain, ">"), m.Line}
+}
+
+// has reports whether m was reported for an earlier root
+func (s *reportedSet) has(m Match) bool {
+	return s.matches[keyOfMatch(m)]
+}
+
+// add drops the matches and writable paths already in s from those found
+// under a root and records the remaining ones
+func (s *reportedSet) add(matches []Match, writable []Writable) ([]Match, []Writable) {
+	var kept []Match
+	for _, m := range matches {
+		if !s.has(m) {
+			kept = append(kept, m)
+		}
+	}
+	for _, m := range kept {
+		s.matches[keyOfMatch(m)] = true
+	}
+	var keptWritable []Writable
+	for _, w := range writable {
+		if !s.writable[w.Path] {
+			keptWritable = append(keptWritable, w)
+		}
+	}
+	for _, w := range keptWritable {
+		s.writable[w.Path] = true
+	}
+	return kept, keptWritable
+}
+
+// depthBelow returns how many directory levels path is below root
+func depthBelow(root, path string) int {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." {
+		return 0
+	}
+	return strings.Count(rel, string(filepath.Separator)) + 1
+}
+
+// DedupeMatches collapses matches with the same name and version into one
+// entry that keeps the first path as representative and lists all of them
+// in Paths. The order of first occurrence is preserved.
+func DedupeMatches(matches []Match) []Match {
+	var unique []Match
+	index := make(map[string]int)
+	for _, m := range matches {
+		key := m.Name + "@" + m.Version
+		if i, ok := index[key]; ok {
+			unique[i].Paths = append(unique[i].Paths, m.Path)
+			continue
+		}
+		index[key] = len(unique)
+		m.Paths = []string{m.Path}
+		unique = append(unique, m)
+	}
+	return unique
+}
+
+// SortMatches orders matches by root, path, name and version for
+// deterministic output, whatever order the roots and files were scanned in.
+// Matches equal in those (e.g. several content rules in one file) are
+// ordered by source, line and rule.
+func SortMatches(matches []Match) {
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if a.Root != b.Root {
+			return a.Root < b.Root
+		}
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		if a.Version != b.Version {
+			return a.Version < b.Version
+		}
+		if a.Source != b.Source {
+			return a.Source < b.Source
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.MatchedRule < b.MatchedRule
+	})
+}
@@ -0,0 +1,434 @@
+package scanner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	// Warnings about the deliberately broken fixtures are noise here
+	Warnings = io.Discard
+	os.Exit(m.Run())
+}
+
+// writeFile creates the file at the slash-separated path below dir,
+// including its parent directories, and returns its full path
+func writeFile(t testing.TB, dir, path, content string) string {
+	t.Helper()
+	full := filepath.Join(dir, filepath.FromSlash(path))
+	if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(full, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return full
+}
+
+// writePackage writes node_modules/<name>/package.json below dir
+func writePackage(t testing.TB, dir, name, version string) {
+	t.Helper()
+	writeFile(t, dir, "node_modules/"+name+"/package.json", `{"name": "`+name+`", "version": "`+version+`"}`)
+}
+
+// matchNames returns "name@version" for each match
+func matchNames(matches []Match) []string {
+	var names []string
+	for _, m := range matches {
+		names = append(names, m.Name+"@"+m.Version)
+	}
+	return names
+}
+
+func TestScanFindsInstalledPackages(t *testing.T) {
+	dir := t.TempDir()
+	writePackage(t, dir, "evil", "1.0.0")
+	writePackage(t, dir, "fine", "2.0.0")
+	writePackage(t, dir, "@scope/bad", "3.1.0")
+	writeFile(t, dir, "node_modules/fine/node_modules/evil/package.json", `{"name": "evil", "version": "1.0.0"}`)
+	// A project manifest outside node_modules is not an installed package
+	writeFile(t, dir, "package.json", `{"name": "evil", "version": "1.0.0"}`)
+
+	result, err := Scan(Options{
+		Roots: []string{dir},
+		IOCs:  mustLoadIOCs(t, "evil,1.0.0\n@scope/bad,^3.0.0\n"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"@scope/bad@3.1.0", "evil@1.0.0", "evil@1.0.0"}
+	got := matchNames(result.Matches)
+	slices.Sort(got)
+	if !slices.Equal(got, want) {
+		t.Errorf("matches = %v, want %v", got, want)
+	}
+	for _, m := range result.Matches {
+		if !filepath.IsAbs(m.Path) || m.Source != SourceInstalled || m.Root != dir {
+			t.Errorf("match %s: path %s, source %s, root %s", m.Name, m.Path, m.Source, m.Root)
+		}
+	}
+	if result.Stats.Packages != 4 {
+		t.Errorf("Stats.Packages = %d, want 4", result.Stats.Packages)
+	}
+}
+
+func TestScanChecksLockfiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "package-lock.json", `{
+  "lockfileVersion": 3,
+  "packages": {
+    "": {"name": "app"},
+    "node_modules/evil": {"version": "1.0.0"}
+  }
+}`)
+
+	result, err := Scan(Options{Roots: []string{dir}, IOCs: mustLoadIOCs(t, "evil,1.0.0\n")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Matches) != 1 || result.Matches[0].Source != SourceLockfile {
+		t.Fatalf("matches = %+v, want one lockfile match", result.Matches)
+	}
+	if result.Stats.Lockfiles != 1 {
+		t.Errorf("Stats.Lockfiles = %d, want 1", result.Stats.Lockfiles)
+	}
+}
+
+func TestScanSkipsMissingRoots(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing")
+	result, err := Scan(Options{Roots: []string{missing}, IOCs: mustLoadIOCs(t, "x,1.0.0\n")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Skipped) != 1 || len(result.Scanned) != 0 {
+		t.Errorf("skipped %v, scanned %v, want only the root skipped", result.Skipped, result.Scanned)
+	}
+}
+
+func TestWalkFiles(t *testing.T) {
+	dir := t.TempDir()
+	writePackage(t, dir, "a", "1.0.0")
+	writeFile(t, dir, "node_modules/a/node_modules/b/package.json", `{"name": "b", "version": "1.0.0"}`)
+	writeFile(t, dir, "yarn.lock", "")
+	writeFile(t, dir, "node_modules/a/index.js", "")
+	writeFile(t, dir, "src/package.json", `{}`)
+
+	tests := []struct {
+		name string
+		opts Options
+		want []string
+	}{
+		{
+			name: "default",
+			want: []string{"node_modules/a/node_modules/b/package.json", "node_modules/a/package.json", "yarn.lock"},
+		},
+		{
+			name: "project manifests with CheckDeps",
+			opts: Options{CheckDeps: true},
+			want: []string{"node_modules/a/node_modules/b/package.json", "node_modules/a/package.json", "src/package.json", "yarn.lock"},
+		},
+		{
+			name: "depth limit",
+			opts: Options{MaxDepth: 2},
+			want: []string{"node_modules/a/package.json", "yarn.lock"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			err := walkFiles(context.Background(), dir, tt.opts, nil, nil, func(path string) {
+				rel, _ := filepath.Rel(dir, path)
+				got = append(got, filepath.ToSlash(rel))
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("walked %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScanContextCancelled(t *testing.T) {
+	dir := t.TempDir()
+	writePackage(t, dir, "evil", "1.0.0")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	result, err := ScanContext(ctx, Options{Roots: []string{dir}, IOCs: mustLoadIOCs(t, "evil,1.0.0\n")})
+	if err != context.Canceled {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+	if len(result.Scanned) != 0 {
+		t.Errorf("scanned %v after cancellation", result.Scanned)
+	}
+}
+
+// benchPackageJSON is a package.json of typical size, with the fields the
+// scanner ignores making up most of it
+const benchPackageJSON = `{
+  "name": "@scope/example",
+  "version": "4.17.21",
+  "description": "An example package of typical size",
+  "keywords": ["example", "benchmark", "fixture", "package", "json"],
+  "homepage": "https://example.com/",
+  "repository": {"type": "git", "url": "git+https://github.com/example/example.git"},
+  "license": "MIT",
+  "main": "index.js",
+  "scripts": {"test": "node test.js", "build": "tsc -p ."},
+  "dependencies": {"a": "^1.0.0", "b": "~2.3.0", "c": ">=3.0.0 <4.0.0"},
+  "devDependencies": {"typescript": "^5.4.0", "eslint": "^9.0.0"},
+  "_resolved": "https://registry.npmjs.org/@scope/example/-/example-4.17.21.tgz",
+  "_integrity": "sha512-v2kDEe57lecTulaDIuNTPy3Ry4gLGJ6Z1O3vE1krgXZNrsQ+LFTGHVxVjcXPs17LhbZVGedAJv8XZ1tvj5FvSg=="
+}`
+
+// BenchmarkReadPackageJSON compares readPackageJSON with reading each file
+// into a new byte slice before unmarshaling it
+func BenchmarkReadPackageJSON(b *testing.B) {
+	path := writeFile(b, b.TempDir(), "package.json", benchPackageJSON)
+
+	b.Run("pooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			if _, err := readPackageJSON(path, DefaultMaxFileSize); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("read-unmarshal", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				b.Fatal(err)
+			}
+			var pkg PackageJSON
+			if err := json.Unmarshal(data, &pkg); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestReadPackageJSONSizeLimit(t *testing.T) {
+	path := writeFile(t, t.TempDir(), "package.json", benchPackageJSON)
+	if _, err := readPackageJSON(path, 100); err != errFileTooLarge {
+		t.Errorf("err = %v, want errFileTooLarge", err)
+	}
+	pkg, err := readPackageJSON(path, int64(len(benchPackageJSON)))
+	if err != nil || pkg.Name != "@scope/example" || pkg.Version != "4.17.21" {
+		t.Errorf("got %+v, %v, want @scope/example@4.17.21", pkg, err)
+	}
+}
+
+func TestScanAllowlistIgnoringBuildMetadata(t *testing.T) {
+	dir := t.TempDir()
+	writePackage(t, dir, "evil", "1.0.0+abc")
+	iocs := mustLoadIOCs(t, "evil,1.0.0\n")
+	allowlist := mustLoadIOCs(t, "evil,1.0.0\n")
+
+	result, err := Scan(Options{Roots: []string{dir}, IOCs: iocs, Allowlist: allowlist})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Matches) != 0 {
+		t.Fatalf("matches = %v without ignoring build metadata, want none", matchNames(result.Matches))
+	}
+
+	iocs.IgnoreBuildMetadata()
+	if result, err = Scan(Options{Roots: []string{dir}, IOCs: iocs, Allowlist: allowlist}); err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Matches) != 1 {
+		t.Fatalf("matches = %v, want evil@1.0.0+abc before allowlisting", matchNames(result.Matches))
+	}
+
+	// The allowlist has to ignore build metadata as well to drop it
+	allowlist.IgnoreBuildMetadata()
+	if result, err = Scan(Options{Roots: []string{dir}, IOCs: iocs, Allowlist: allowlist}); err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Matches) != 0 {
+		t.Errorf("matches = %v, want the allowlisted package dropped", matchNames(result.Matches))
+	}
+}
+
+// openFDs returns the number of file descriptors open in the process, or
+// skips the test where /proc/self/fd is not available
+func openFDs(t *testing.T) int {
+	t.Helper()
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		t.Skipf("cannot count open files: %v", err)
+	}
+	return len(entries)
+}
+
+func TestScanClosesFiles(t *testing.T) {
+	dir := t.TempDir()
+	for i := range 500 {
+		name := fmt.Sprintf("pkg-%d", i)
+		switch i % 4 {
+		case 0:
+			writePackage(t, dir, name, "1.0.0")
+		case 1:
+			// Unparseable, so the file is given up on early
+			writeFile(t, dir, "node_modules/"+name+"/package.json", `{"name": `)
+		case 2:
+			// Over the size limit
+			writeFile(t, dir, "node_modules/"+name+"/package.json", `{"name": "`+name+`", "description": "`+strings.Repeat("x", 200)+`"}`)
+		case 3:
+			writeFile(t, dir, "project-"+name+"/package-lock.json", `{"packages": {"node_modules/`+name+`": {"version": "1.0.0"}}}`)
+		}
+	}
+
+	before := openFDs(t)
+	_, err := Scan(Options{
+		Roots:       []string{dir},
+		IOCs:        mustLoadIOCs(t, "pkg-0,1.0.0\n"),
+		MaxFileSize: 200,
+		Workers:     4,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after := openFDs(t); after > before {
+		t.Errorf("%d files open after the scan, %d before", after, before)
+	}
+}
+
+func TestScanOrderIndependentOfRoots(t *testing.T) {
+	dir := t.TempDir()
+	var roots []string
+	for _, project := range []string{"c", "a", "d", "b", "e"} {
+		root := filepath.Join(dir, project)
+		writePackage(t, root, "evil", "1.0.0")
+		writePackage(t, root, "@scope/bad", "2.0.0")
+		writeFile(t, root, "node_modules/zzz/node_modules/evil/package.json", `{"name": "evil", "version": "1.0.0"}`)
+		writeFile(t, root, "package-lock.json", `{"packages": {"node_modules/evil": {"version": "1.0.0"}}}`)
+		roots = append(roots, root)
+	}
+	iocs := mustLoadIOCs(t, "evil,1.0.0\n@scope/bad,2.0.0\n")
+
+	scan := func(roots []string) []Match {
+		t.Helper()
+		result, err := Scan(Options{Roots: roots, IOCs: iocs, Workers: 4})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result.Matches
+	}
+	want := scan(roots)
+	if len(want) != 20 {
+		t.Fatalf("got %d matches, want 20", len(want))
+	}
+	rng := rand.New(rand.NewPCG(1, 2))
+	for range 10 {
+		shuffled := slices.Clone(roots)
+		rng.Shuffle(len(shuffled), func(i, j int) {
+			shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+		})
+		if got := scan(shuffled); !slices.EqualFunc(got, want, func(a, b Match) bool {
+			return a.Root == b.Root && a.Path == b.Path && a.Name == b.Name && a.Version == b.Version && a.Source == b.Source
+		}) {
+			t.Fatalf("roots %v: matches in a different order", shuffled)
+		}
+	}
+}
+
+func TestReadPackageJSONRobust(t *testing.T) {
+	var logs strings.Builder
+	defer func(logger *slog.Logger) { Logger = logger }(Logger)
+	Logger = slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	tests := []struct {
+		fixture string
+		log     []string // debug messages expected for the cleanup
+	}{
+		{"bom", []string{"skipped byte order mark"}},
+		{"trailing-newlines", nil},
+		{"trailing-garbage", []string{"ignored data after the JSON object"}},
+		{"bom-and-garbage", []string{"skipped byte order mark", "ignored data after the JSON object"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			logs.Reset()
+			pkg, err := readPackageJSON(filepath.Join("testdata", "robust", "node_modules", tt.fixture, "package.json"), DefaultMaxFileSize)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if pkg.Name != tt.fixture || pkg.Version != "1.0.0" {
+				t.Errorf("got %s@%s, want %s@1.0.0", pkg.Name, pkg.Version, tt.fixture)
+			}
+			for _, msg := range tt.log {
+				if !strings.Contains(logs.String(), msg) {
+					t.Errorf("no debug message %q in %q", msg, logs.String())
+				}
+			}
+			if tt.log == nil && logs.Len() > 0 {
+				t.Errorf("unexpected debug messages: %q", logs.String())
+			}
+		})
+	}
+
+	if _, err := readPackageJSON(filepath.Join("testdata", "robust", "node_modules", "broken", "package.json"), DefaultMaxFileSize); err == nil {
+		t.Error("garbage before the JSON object parsed without error")
+	}
+}
+
+func TestScanRobustFixtures(t *testing.T) {
+	result, err := Scan(Options{
+		Roots: []string{filepath.Join("testdata", "robust")},
+		IOCs:  mustLoadIOCs(t, "bom,1.0.0\ntrailing-newlines,1.0.0\ntrailing-garbage,1.0.0\nbom-and-garbage,1.0.0\nbroken,1.0.0\n"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := matchNames(result.Matches)
+	want := []string{"bom@1.0.0", "bom-and-garbage@1.0.0", "trailing-garbage@1.0.0", "trailing-newlines@1.0.0"}
+	if !slices.Equal(got, want) {
+		t.Errorf("matches = %v, want %v", got, want)
+	}
+	if result.Stats.ParseErrors != 1 {
+		t.Errorf("Stats.ParseErrors = %d, want 1 for the broken fixture", result.Stats.ParseErrors)
+	}
+}
+
+// BenchmarkScan scans a synthetic tree of 3000 installed packages with a
+// single worker and with one per CPU
+func BenchmarkScan(b *testing.B) {
+	dir := b.TempDir()
+	for i := range 3000 {
+		writePackage(b, dir, fmt.Sprintf("pkg-%d", i), "1.0.0")
+	}
+	iocs := mustLoadIOCs(b, "pkg-42,1.0.0\n")
+
+	for _, bc := range []struct {
+		name    string
+		workers int
+	}{{"workers-1", 1}, {"workers-numcpu", runtime.NumCPU()}} {
+		b.Run(bc.name, func(b *testing.B) {
+			for b.Loop() {
+				result, err := Scan(Options{Roots: []string{dir}, IOCs: iocs, Workers: bc.workers})
+				if err != nil {
+					b.Fatal(err)
+				}
+				if len(result.Matches) != 1 {
+					b.Fatalf("got %d matches, want 1", len(result.Matches))
+				}
+			}
+		})
+	}
+}
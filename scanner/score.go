@@ -0,0 +1,118 @@
+package scanner
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DefaultScoreThreshold is the default Options.ScoreThreshold
+const DefaultScoreThreshold = 3
+
+// Suspicion score signals and their weights. They are heuristics for
+// ordering a triage list, not evidence; IOC matches are reported regardless.
+const (
+	scoreInstallScripts = 3 // runs code on install, the usual malware vector
+	scoreObfuscated     = 3 // main file has long high-entropy lines
+	scoreRecentlyMod    = 2 // package.json modified within recentModWindow
+	scoreNoRepository   = 1 // no repository to review the source at
+	scoreOneMaintainer  = 1 // a single account could have published it
+)
+
+// recentModWindow is how recently a package must have been modified to
+// count as recent
+const recentModWindow = 7 * 24 * time.Hour
+
+// Obfuscation heuristic: a line at least obfuscatedLineLen bytes long whose
+// byte entropy is at least obfuscatedEntropy bits. Minified code stays
+// below that; packed or encoded payloads usually exceed it.
+const (
+	obfuscatedLineLen = 1000
+	obfuscatedEntropy = 5.5
+)
+
+// scorePackage computes the suspicion score of an installed package and
+// the reasons for it
+func (c *fileChecker) scorePackage(pkg *PackageJSON, packageDir string) (int, []string) {
+	score := 0
+	var reasons []string
+	add := func(weight int, reason string) {
+		score += weight
+		reasons = append(reasons, reason)
+	}
+
+	if len(installScripts(pkg)) > 0 {
+		add(scoreInstallScripts, "install scripts")
+	}
+	if isObfuscated(filepath.Join(packageDir, pkg.mainFile()), c.maxFileSize) {
+		add(scoreObfuscated, "obfuscated main file")
+	}
+	if info, err := os.Stat(filepath.Join(packageDir, "package.json")); err == nil && time.Since(info.ModTime()) < recentModWindow {
+		add(scoreRecentlyMod, "recently modified")
+	}
+	if len(bytes.TrimSpace(pkg.Repository)) == 0 || string(bytes.TrimSpace(pkg.Repository)) == "null" {
+		add(scoreNoRepository, "no repository")
+	}
+	if len(pkg.Maintainers) == 1 {
+		add(scoreOneMaintainer, "single maintainer")
+	}
+	return score, reasons
+}
+
+// mainFile returns the package's entry point relative to its directory
+func (p *PackageJSON) mainFile() string {
+	main := p.Main
+	if main == "" {
+		main = "index.js"
+	}
+	if filepath.Ext(main) == "" {
+		main += ".js"
+	}
+	return filepath.FromSlash(main)
+}
+
+// isObfuscated reports whether the file has a long line of high entropy.
+// Missing, too large and unreadable files are not.
+func isObfuscated(path string, maxSize int64) bool {
+	file, err := openFile(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	data, err := io.ReadAll(&io.LimitedReader{R: file, N: maxSize + 1})
+	if err != nil || int64(len(data)) > maxSize {
+		return false
+	}
+	for len(data) > 0 {
+		line := data
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			line, data = data[:i], data[i+1:]
+		} else {
+			data = nil
+		}
+		if len(line) >= obfuscatedLineLen && entropy(line) >= obfuscatedEntropy {
+			return true
+		}
+	}
+	return false
+}
+
+// entropy returns the Shannon entropy of b in bits per byte
+func entropy(b []byte) float64 {
+	var counts [256]int
+	for _, c := range b {
+		counts[c]++
+	}
+	h := 0.0
+	n := float64(len(b))
+	for _, count := range counts {
+		if count > 0 {
+			p := float64(count) / n
+			h -= p * math.Log2(p)
+		}
+	}
+	return h
+}
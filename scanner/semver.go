@@ -0,0 +1,405 @@
+package scanner
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// semver is a parsed semantic version (build metadata is ignored)
+type semver struct {
+	major, minor, patch int64
+	pre                 []string
+}
+
+// comparator is a single primitive constraint such as ">=1.2.3"
+type comparator struct {
+	op  string // one of "<", "<=", ">", ">=", "="
+	ver semver
+}
+
+// semverRange is a set of comparator groups joined by "||";
+// a version satisfies the range if it satisfies every comparator of any group
+type semverRange [][]comparator
+
+var (
+	semverPattern  = regexp.MustCompile(`^[v=]*(\d+)\.(\d+)\.(\d+)(?:-([0-9A-Za-z.-]+))?(?:\+[0-9A-Za-z.-]+)?$`)
+	partialPattern = regexp.MustCompile(`^[v=]*(\d+|[xX*])(?:\.(\d+|[xX*]))?(?:\.(\d+|[xX*]))?(?:-([0-9A-Za-z.-]+))?(?:\+[0-9A-Za-z.-]+)?$`)
+	opSpacePattern = regexp.MustCompile(`(<=|>=|<|>|=|~|\^)\s+`)
+)
+
+// parseSemver parses a full version like "1.2.3", "v1.2.3-beta.1" or "1.2.3+build"
+func parseSemver(s string) (semver, bool) {
+	m := semverPattern.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return semver{}, false
+	}
+	var v semver
+	var err error
+	if v.major, err = strconv.ParseInt(m[1], 10, 64); err != nil {
+		return semver{}, false
+	}
+	if v.minor, err = strconv.ParseInt(m[2], 10, 64); err != nil {
+		return semver{}, false
+	}
+	if v.patch, err = strconv.ParseInt(m[3], 10, 64); err != nil {
+		return semver{}, false
+	}
+	if m[4] != "" {
+		v.pre = strings.Split(m[4], ".")
+	}
+	return v, true
+}
+
+// compare returns -1, 0 or 1 depending on whether v is lower, equal or higher than o
+func (v semver) compare(o semver) int {
+	for _, d := range []int64{v.major - o.major, v.minor - o.minor, v.patch - o.patch} {
+		if d < 0 {
+			return -1
+		}
+		if d > 0 {
+			return 1
+		}
+	}
+
+	// A version without prerelease has higher precedence than one with
+	switch {
+	case len(v.pre) == 0 && len(o.pre) == 0:
+		return 0
+	case len(v.pre) == 0:
+		return 1
+	case len(o.pre) == 0:
+		return -1
+	}
+
+	for i := 0; i < len(v.pre) && i < len(o.pre); i++ {
+		if c := comparePrerelease(v.pre[i], o.pre[i]); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case len(v.pre) < len(o.pre):
+		return -1
+	case len(v.pre) > len(o.pre):
+		return 1
+	}
+	return 0
+}
+
+// comparePrerelease compares two prerelease identifiers; numeric identifiers
+// sort numerically and always lower than alphanumeric ones
+func comparePrerelease(a, b string) int {
+	an, aErr := strconv.ParseInt(a, 10, 64)
+	bn, bErr := strconv.ParseInt(b, 10, 64)
+	switch {
+	case aErr == nil && bErr == nil:
+		switch {
+		case an < bn:
+			return -1
+		case an > bn:
+			return 1
+		}
+		return 0
+	case aErr == nil:
+		return -1
+	case bErr == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// sameTuple reports whether both versions share major, minor and patch
+func (v semver) sameTuple(o semver) bool {
+	return v.major == o.major && v.minor == o.minor && v.patch == o.patch
+}
+
+// satisfies checks a version against a single comparator
+func (c comparator) satisfies(v semver) bool {
+	cmp := v.compare(c.ver)
+	switch c.op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	default:
+		return cmp == 0
+	}
+}
+
+// partial is a possibly incomplete version; -1 marks a wildcard/missing part
+type partial struct {
+	major, minor, patch int64
+	pre                 []string
+}
+
+// parsePartial parses versions like "1", "1.2", "1.x", "*" or "1.2.3-beta"
+func parsePartial(s string) (partial, bool) {
+	if s == "" {
+		return partial{-1, -1, -1, nil}, true
+	}
+	m := partialPattern.FindStringSubmatch(s)
+	if m == nil {
+		return partial{}, false
+	}
+	p := partial{-1, -1, -1, nil}
+	parts := []*int64{&p.major, &p.minor, &p.patch}
+	for i, field := range m[1:4] {
+		if field == "" || field == "x" || field == "X" || field == "*" {
+			// Everything after a wildcard is a wildcard as well
+			break
+		}
+		n, err := strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			return partial{}, false
+		}
+		*parts[i] = n
+	}
+	if m[4] != "" {
+		if p.patch < 0 {
+			return partial{}, false
+		}
+		p.pre = strings.Split(m[4], ".")
+	}
+	return p, true
+}
+
+// lower returns the lowest version covered by the partial
+func (p partial) lower() semver {
+	return semver{max(p.major, 0), max(p.minor, 0), max(p.patch, 0), p.pre}
+}
+
+// upperExclusive returns the first version above the partial; ok is false if
+// the partial is a full version or "*" and has no such bound
+func (p partial) upperExclusive() (semver, bool) {
+	zero := []string{"0"}
+	switch {
+	case p.major < 0:
+		return semver{}, false
+	case p.minor < 0:
+		return semver{p.major + 1, 0, 0, zero}, true
+	case p.patch < 0:
+		return semver{p.major, p.minor + 1, 0, zero}, true
+	}
+	return semver{}, false
+}
+
+// parseSemverRange parses an npm-style range expression such as
+// ">=4.0.0 <4.17.21", "^4.17.0", "~1.2", "1.x", "1.0.0 - 2.0.0" or "1.0.0 || 2.0.0"
+func parseSemverRange(expr string) (semverRange, error) {
+	var r semverRange
+	for _, group := range strings.Split(expr, "||") {
+		comps, err := parseComparatorGroup(strings.TrimSpace(group))
+		if err != nil {
+			return nil, err
+		}
+		r = append(r, comps)
+	}
+	return r, nil
+}
+
+// parseComparatorGroup parses one "||"-separated part of a range
+func parseComparatorGroup(group string) ([]comparator, error) {
+	group = opSpacePattern.ReplaceAllString(group, "$1")
+	fields := strings.Fields(group)
+
+	// Hyphen range: "a - b"
+	if len(fields) == 3 && fields[1] == "-" {
+		from, ok := parsePartial(fields[0])
+		if !ok {
+			return nil, fmt.Errorf("invalid version %q", fields[0])
+		}
+		to, ok := parsePartial(fields[2])
+		if !ok {
+			return nil, fmt.Errorf("invalid version %q", fields[2])
+		}
+		comps := []comparator{{">=", from.lower()}}
+		if upper, ok := to.upperExclusive(); ok {
+			comps = append(comps, comparator{"<", upper})
+		} else if to.major >= 0 {
+			comps = append(comps, comparator{"<=", to.lower()})
+		}
+		return comps, nil
+	}
+
+	if len(fields) == 0 {
+		return []comparator{{">=", semver{}}}, nil
+	}
+
+	var comps []comparator
+	for _, f := range fields {
+		c, err := parseComparator(f)
+		if err != nil {
+			return nil, err
+		}
+		comps = append(comps, c...)
+	}
+	return comps, nil
+}
+
+// parseComparator desugars a single token (with optional operator) into primitive comparators
+func parseComparator(token string) ([]comparator, error) {
+	op := ""
+	for _, candidate := range []string{"<=", ">=", "<", ">", "=", "~", "^"} {
+		if strings.HasPrefix(token, candidate) {
+			op = candidate
+			break
+		}
+	}
+	p, ok := parsePartial(strings.TrimPrefix(token, op))
+	if !ok {
+		return nil, fmt.Errorf("invalid comparator %q", token)
+	}
+	zero := []string{"0"}
+	anyVersion := []comparator{{">=", semver{}}}
+	none := []comparator{{"<", semver{0, 0, 0, zero}}}
+
+	switch op {
+	case "~":
+		if p.major < 0 {
+			return anyVersion, nil
+		}
+		upper := semver{p.major, p.minor + 1, 0, zero}
+		if p.minor < 0 {
+			upper = semver{p.major + 1, 0, 0, zero}
+		}
+		return []comparator{{">=", p.lower()}, {"<", upper}}, nil
+
+	case "^":
+		if p.major < 0 {
+			return anyVersion, nil
+		}
+		var upper semver
+		switch {
+		case p.major > 0 || p.minor < 0:
+			upper = semver{p.major + 1, 0, 0, zero}
+		case p.minor > 0 || p.patch < 0:
+			upper = semver{0, p.minor + 1, 0, zero}
+		default:
+			upper = semver{0, 0, p.patch + 1, zero}
+		}
+		return []comparator{{">=", p.lower()}, {"<", upper}}, nil
+
+	case "", "=":
+		if p.major < 0 {
+			return anyVersion, nil
+		}
+		if upper, ok := p.upperExclusive(); ok {
+			return []comparator{{">=", p.lower()}, {"<", upper}}, nil
+		}
+		return []comparator{{"=", p.lower()}}, nil
+
+	case ">":
+		if p.major < 0 {
+			return none, nil
+		}
+		if upper, ok := p.upperExclusive(); ok {
+			return []comparator{{">=", upper}}, nil
+		}
+		return []comparator{{">", p.lower()}}, nil
+
+	case ">=":
+		return []comparator{{">=", p.lower()}}, nil
+
+	case "<":
+		if p.major < 0 {
+			return none, nil
+		}
+		if _, ok := p.upperExclusive(); ok {
+			v := p.lower()
+			v.pre = zero
+			return []comparator{{"<", v}}, nil
+		}
+		return []comparator{{"<", p.lower()}}, nil
+
+	case "<=":
+		if p.major < 0 {
+			return anyVersion, nil
+		}
+		if upper, ok := p.upperExclusive(); ok {
+			return []comparator{{"<", upper}}, nil
+		}
+		return []comparator{{"<=", p.lower()}}, nil
+	}
+	return nil, fmt.Errorf("invalid comparator %q", token)
+}
+
+// contains reports whether the version satisfies the range. Like npm, a
+// prerelease version only matches if a comparator in the same group
+// carries a prerelease on the same major.minor.patch tuple.
+func (r semverRange) contains(v semver) bool {
+	for _, group := range r {
+		if groupSatisfied(group, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// groupSatisfied checks a version against all comparators of one group
+func groupSatisfied(group []comparator, v semver) bool {
+	for _, c := range group {
+		if !c.satisfies(v) {
+			return false
+		}
+	}
+	if len(v.pre) == 0 {
+		return true
+	}
+	for _, c := range group {
+		if len(c.ver.pre) > 0 && c.ver.sameTuple(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// bound is one end of the version interval allowed by a comparator group
+type bound struct {
+	ver       semver
+	inclusive bool
+	set       bool
+}
+
+// groupInterval returns the interval of versions allowed by all comparators
+func groupInterval(group []comparator) (lo, hi bound) {
+	for _, c := range group {
+		b := bound{c.ver, c.op != ">" && c.op != "<", true}
+		if c.op != "<" && c.op != "<=" {
+			// Lower bounds: the higher one (or the exclusive one on a tie) wins
+			if cmp := b.ver.compare(lo.ver); !lo.set || cmp > 0 || (cmp == 0 && !b.inclusive) {
+				lo = b
+			}
+		}
+		if c.op != ">" && c.op != ">=" {
+			if cmp := b.ver.compare(hi.ver); !hi.set || cmp < 0 || (cmp == 0 && !b.inclusive) {
+				hi = b
+			}
+		}
+	}
+	return lo, hi
+}
+
+// overlaps reports whether some version satisfies both ranges. Unlike
+// contains it ignores the prerelease rule, as it compares intervals.
+func (r semverRange) overlaps(o semverRange) bool {
+	for _, a := range r {
+		for _, b := range o {
+			lo, hi := groupInterval(append(a[:len(a):len(a)], b...))
+			if !lo.set || !hi.set {
+				return true
+			}
+			switch cmp := lo.ver.compare(hi.ver); {
+			case cmp < 0:
+				return true
+			case cmp == 0 && lo.inclusive && hi.inclusive:
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,117 @@
+package scanner
+
+import "testing"
+
+func TestParseSemver(t *testing.T) {
+	tests := []struct {
+		in string
+		ok bool
+	}{
+		{"1.2.3", true},
+		{"v1.2.3", true},
+		{"1.2.3-beta.1", true},
+		{"1.2.3+build.5", true},
+		{"1.2", false},
+		{"latest", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if _, ok := parseSemver(tt.in); ok != tt.ok {
+			t.Errorf("parseSemver(%q) ok = %v, want %v", tt.in, ok, tt.ok)
+		}
+	}
+}
+
+func TestSemverCompare(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.0.0", "1.0.0", 0},
+		{"1.0.0", "1.0.1", -1},
+		{"1.10.0", "1.9.0", 1},
+		{"1.0.0-alpha", "1.0.0", -1},
+		{"1.0.0-alpha", "1.0.0-alpha.1", -1},
+		{"1.0.0-alpha.2", "1.0.0-alpha.10", -1},
+		{"1.0.0-beta", "1.0.0-alpha", 1},
+	}
+	for _, tt := range tests {
+		a, _ := parseSemver(tt.a)
+		b, _ := parseSemver(tt.b)
+		if got := a.compare(b); got != tt.want {
+			t.Errorf("compare(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestSemverRangeContains(t *testing.T) {
+	tests := []struct {
+		rng, version string
+		want         bool
+	}{
+		{"^1.2.3", "1.9.0", true},
+		{"^1.2.3", "2.0.0", false},
+		{"^1.2.3", "1.2.2", false},
+		{"^0.2.3", "0.2.9", true},
+		{"^0.2.3", "0.3.0", false},
+		{"~1.2.3", "1.2.9", true},
+		{"~1.2.3", "1.3.0", false},
+		{">=4.0.0 <4.17.21", "4.17.20", true},
+		{">=4.0.0 <4.17.21", "4.17.21", false},
+		{"1.x", "1.5.0", true},
+		{"1.x", "2.0.0", false},
+		{"1.2.3 - 1.4.0", "1.4.0", true},
+		{"1.2.3 - 1.4.0", "1.4.1", false},
+		{"<1.0.0 || >=2.0.0", "0.9.0", true},
+		{"<1.0.0 || >=2.0.0", "1.5.0", false},
+		{"*", "3.1.4", true},
+		// Prereleases only satisfy comparators on the same version tuple
+		{"^1.0.0", "1.1.0-beta", false},
+		{">=1.1.0-alpha", "1.1.0-beta", true},
+	}
+	for _, tt := range tests {
+		r, err := parseSemverRange(tt.rng)
+		if err != nil {
+			t.Errorf("parseSemverRange(%q): %v", tt.rng, err)
+			continue
+		}
+		v, ok := parseSemver(tt.version)
+		if !ok {
+			t.Fatalf("parseSemver(%q) failed", tt.version)
+		}
+		if got := r.contains(v); got != tt.want {
+			t.Errorf("%q contains %q = %v, want %v", tt.rng, tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestSemverRangeOverlaps(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"^1.0.0", "1.5.0", true},
+		{"^1.0.0", ">=2.0.0", false},
+		{"<1.2.0", ">=1.1.0 <1.3.0", true},
+		{"<1.2.0", ">=1.2.0", false},
+		{"~2.1.0", "^2.0.0", true},
+	}
+	for _, tt := range tests {
+		a, errA := parseSemverRange(tt.a)
+		b, errB := parseSemverRange(tt.b)
+		if errA != nil || errB != nil {
+			t.Fatalf("parsing %q or %q: %v, %v", tt.a, tt.b, errA, errB)
+		}
+		if got := a.overlaps(b); got != tt.want {
+			t.Errorf("%q overlaps %q = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestParseSemverRangeErrors(t *testing.T) {
+	for _, rng := range []string{"abc", "1.2.3.4", "=>1", "1.2.3 -"} {
+		if _, err := parseSemverRange(rng); err == nil {
+			t.Errorf("parseSemverRange(%q) succeeded, want an error", rng)
+		}
+	}
+}
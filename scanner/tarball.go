@@ -0,0 +1,107 @@
+package scanner
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha1"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"io"
+	"strings"
+)
+
+// isTarball reports whether a file name looks like a gzipped package tarball
+func isTarball(name string) bool {
+	return strings.HasSuffix(name, ".tgz") || strings.HasSuffix(name, ".tar.gz")
+}
+
+// errNoManifest is returned for tarballs without a top-level package.json
+var errNoManifest = errors.New("no package.json in tarball")
+
+// readTarball reads the package.json of an npm package tarball, which npm
+// puts in a single top-level directory (usually "package/"). Only the tar
+// headers are read up to that member, nothing is extracted. With hash set,
+// the rest of the file is read as well to compute its integrity in the
+// "sha512-<base64> sha1-<base64>" form npm uses.
+func readTarball(path string, maxSize int64, hash bool) (*PackageJSON, string, error) {
+	file, err := openFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+	defer file.Close()
+
+	sum512, sum1 := sha512.New(), sha1.New()
+	var r io.Reader = file
+	if hash {
+		r = io.TeeReader(file, io.MultiWriter(sum512, sum1))
+	}
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, "", err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	var pkg *PackageJSON
+	for pkg == nil {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil, "", errNoManifest
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		dir, name, ok := strings.Cut(strings.TrimPrefix(header.Name, "./"), "/")
+		if !ok || dir == "" || name != "package.json" || header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if header.Size > maxSize {
+			return nil, "", errFileTooLarge
+		}
+		if pkg, err = decodePackageJSON(tr, path+":"+header.Name); err != nil {
+			return nil, "", err
+		}
+	}
+
+	if !hash {
+		return pkg, "", nil
+	}
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		return nil, "", err
+	}
+	integrity := "sha512-" + base64.StdEncoding.EncodeToString(sum512.Sum(nil)) +
+		" sha1-" + base64.StdEncoding.EncodeToString(sum1.Sum(nil))
+	return pkg, integrity, nil
+}
+
+// checkTarball reads the package.json of a package tarball and returns a
+// match if its name and version or the tarball's hash are IOC-listed
+func (c *fileChecker) checkTarball(path string) *Match {
+	c.counters.packageFiles.Add(1)
+	pkg, integrity, err := readTarball(path, c.maxFileSize, c.iocs.hasIntegrity())
+	if err != nil {
+		c.counters.parseErrors.Add(1)
+		debugf("cannot read package tarball %s: %v", path, err)
+		return nil
+	}
+	c.counters.packages.Add(1)
+	debugf("parsed tarball %s: %s@%s", path, pkg.Name, pkg.Version)
+	if pkg.Name == "" || pkg.Version == "" || !isIncluded(pkg.Name, c.include) {
+		return nil
+	}
+
+	if ioc := c.iocs.Lookup(pkg.Name, pkg.Version); ioc != nil {
+		match := newMatch(pkg.Name, pkg.Version, path, SourceTarball, ioc)
+		return &match
+	}
+	if ioc := c.iocs.LookupIntegrity(integrity); ioc != nil {
+		match := newMatch(pkg.Name, pkg.Version, path, SourceTarball, ioc)
+		match.Integrity = ioc.Version
+		return &match
+	}
+	if c.inventory {
+		return &Match{Name: pkg.Name, Version: pkg.Version, Path: path, Source: SourceTarball}
+	}
+	return nil
+}
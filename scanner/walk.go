@@ -0,0 +1,143 @@
+package scanner
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// walkTree walks the tree rooted at root like filepath.Walk. If
+// followSymlinks is set, symlinks to directories are descended into as well,
+// with paths reported below the link rather than below the link target.
+//
+// Loop protection: filepath.Walk itself never follows links, so every
+// directory it enters below a resolved root has a known real path (the
+// resolved root joined with the relative path). Each of those real paths is
+// recorded, and a symlink is only descended into if its resolved target has
+// not been entered yet. This stops cycles (a link pointing to an ancestor)
+// as well as repeated scans of a target reachable through several links.
+//
+// Independently of that, every directory is identified by its device and
+// inode number (os.SameFile where those are unavailable), and one already
+// entered is skipped, so bind mounts and hardlinked directories that lead
+// back into the tree are not walked twice either.
+func walkTree(root string, followSymlinks bool, fn filepath.WalkFunc) error {
+	// On Windows, walk the extended-length form of the root so deep trees
+	// stay reachable, but report paths in the form the root was given in
+	if walkRoot := longPath(root); walkRoot != root {
+		return walkTree(walkRoot, followSymlinks, func(path string, info os.FileInfo, err error) error {
+			return fn(root+strings.TrimPrefix(path, walkRoot), info, err)
+		})
+	}
+
+	visited := newVisitedDirs()
+	userFn := fn
+	fn = func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.IsDir() && !visited.visit(info) {
+			return filepath.SkipDir
+		}
+		return userFn(path, info, err)
+	}
+
+	if !followSymlinks {
+		return filepath.Walk(root, fn)
+	}
+
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return filepath.Walk(root, fn)
+	}
+	w := &symlinkWalker{visited: make(map[string]bool), fn: fn}
+	return w.walk(root, realRoot, false)
+}
+
+// symlinkWalker holds the state of a symlink-following walk
+type symlinkWalker struct {
+	visited map[string]bool // real paths of directories entered
+	fn      filepath.WalkFunc
+}
+
+// walk walks realRoot, reporting paths relative to displayRoot. If
+// rootReported is set, fn has already been called for the root itself.
+func (w *symlinkWalker) walk(displayRoot, realRoot string, rootReported bool) error {
+	return filepath.Walk(realRoot, func(path string, info os.FileInfo, err error) error {
+		display := displayRoot
+		if rel, relErr := filepath.Rel(realRoot, path); relErr == nil && rel != "." {
+			display = filepath.Join(displayRoot, rel)
+		}
+
+		if err != nil {
+			return w.fn(display, info, err)
+		}
+
+		if info.IsDir() {
+			if w.visited[path] {
+				return filepath.SkipDir
+			}
+			w.visited[path] = true
+			if path == realRoot && rootReported {
+				return nil
+			}
+			return w.fn(display, info, nil)
+		}
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			target, err := filepath.EvalSymlinks(path)
+			if err != nil {
+				return w.fn(display, info, nil)
+			}
+			targetInfo, err := os.Stat(target)
+			if err != nil || !targetInfo.IsDir() {
+				return w.fn(display, info, nil)
+			}
+			if w.visited[target] {
+				return nil
+			}
+			// Let fn decide (e.g. excludes or depth limits) before descending
+			if err := w.fn(display, targetInfo, nil); err != nil {
+				if err == filepath.SkipDir {
+					return nil
+				}
+				return err
+			}
+			return w.walk(display, target, true)
+		}
+
+		return w.fn(display, info, nil)
+	})
+}
+
+// fileID identifies a file by device and inode number
+type fileID struct {
+	dev, ino uint64
+}
+
+// visitedDirs records the directories a walk entered
+type visitedDirs struct {
+	ids    map[fileID]bool
+	byName map[string][]os.FileInfo // without file IDs, by name for os.SameFile
+}
+
+func newVisitedDirs() *visitedDirs {
+	return &visitedDirs{ids: make(map[fileID]bool), byName: make(map[string][]os.FileInfo)}
+}
+
+// visit records a directory and reports whether it was not entered before
+func (v *visitedDirs) visit(info os.FileInfo) bool {
+	if id, ok := statFileID(info); ok {
+		if v.ids[id] {
+			return false
+		}
+		v.ids[id] = true
+		return true
+	}
+	// Comparing with every directory would be quadratic; a directory
+	// reached again usually has the same name (e.g. node_modules/foo)
+	for _, seen := range v.byName[info.Name()] {
+		if os.SameFile(seen, info) {
+			return false
+		}
+	}
+	v.byName[info.Name()] = append(v.byName[info.Name()], info)
+	return true
+}
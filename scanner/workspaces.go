@@ -0,0 +1,76 @@
+package scanner
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Workspaces holds the workspace globs of a package.json, which npm and
+// Yarn accept either as an array or as an object with a "packages" array
+type Workspaces []string
+
+// UnmarshalJSON accepts both the array and the {"packages": [...]} form.
+// Other values are ignored rather than failing the whole package.json.
+func (w *Workspaces) UnmarshalJSON(data []byte) error {
+	var list []string
+	if err := json.Unmarshal(data, &list); err == nil {
+		*w = list
+		return nil
+	}
+	var object struct {
+		Packages []string `json:"packages"`
+	}
+	if err := json.Unmarshal(data, &object); err == nil {
+		*w = object.Packages
+	}
+	return nil
+}
+
+// WorkspaceRoots returns the workspace directories declared by the project
+// at root, so their own node_modules are scanned as well. For a root inside
+// a node_modules directory (e.g. "project/node_modules"), the project
+// manifest above it is used. Negated globs ("!packages/old") exclude
+// directories matched by earlier ones.
+func WorkspaceRoots(root string) []string {
+	project := filepath.Clean(root)
+	if filepath.Base(project) == "node_modules" {
+		project = filepath.Dir(project)
+	}
+	manifest := filepath.Join(project, "package.json")
+	pkg, err := readPackageJSON(manifest, DefaultMaxFileSize)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			debugf("cannot read workspaces from %s: %v", manifest, err)
+		}
+		return nil
+	}
+
+	var dirs []string
+	for _, pattern := range pkg.Workspaces {
+		if negated, ok := strings.CutPrefix(pattern, "!"); ok {
+			excluded := filepath.Join(project, filepath.FromSlash(negated))
+			kept := dirs[:0]
+			for _, dir := range dirs {
+				if match, _ := filepath.Match(excluded, dir); !match {
+					kept = append(kept, dir)
+				}
+			}
+			dirs = kept
+			continue
+		}
+		matches, err := filepath.Glob(filepath.Join(project, filepath.FromSlash(pattern)))
+		if err != nil {
+			warnf("invalid workspace pattern %q in %s: %v\n", pattern, manifest, err)
+			continue
+		}
+		for _, dir := range matches {
+			// Only directories holding a package are workspaces
+			if _, err := os.Stat(filepath.Join(dir, "package.json")); err == nil {
+				dirs = append(dirs, dir)
+			}
+		}
+	}
+	return dirs
+}